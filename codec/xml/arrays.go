@@ -0,0 +1,47 @@
+package xml
+
+import (
+	"strings"
+)
+
+// forceArray returns true if the element at 'path' should always be a list
+func (c *Codec) forceArray(path string) bool {
+	for _, p := range c.ForceArray {
+		if p == path {
+			return true
+		}
+	}
+	return false
+}
+
+// unwrapArrays replaces single element lists at the ForceArray paths in 'm' with the element itself
+func (c *Codec) unwrapArrays(m map[string]interface{}) {
+	for _, path := range c.ForceArray {
+		if len(c.Target) > 0 {
+			path = c.Target + "." + path
+		}
+		unwrapPath(m, strings.Split(path, "."))
+	}
+}
+
+// unwrapPath follows 'keys' from 'value' and unwraps the list at the end
+func unwrapPath(value interface{}, keys []string) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		child, ok := v[keys[0]]
+		if !ok {
+			return
+		}
+		if len(keys) > 1 {
+			unwrapPath(child, keys[1:])
+			return
+		}
+		if list, ok := child.([]interface{}); ok && len(list) == 1 {
+			v[keys[0]] = list[0]
+		}
+	case []interface{}:
+		for i := range v {
+			unwrapPath(v[i], keys)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package xml
+
+import (
+	"strings"
+)
+
+// attrKey returns the key used for attribute 'name'
+func (c *Codec) attrKey(name string) string {
+	if c.AttrsAsFields {
+		return name
+	}
+	if len(c.AttrPrefix) == 0 {
+		return mxjAttrPrefix + name
+	}
+	return c.AttrPrefix + name
+}
+
+// textKey returns the key used for text in elements that also has attributes or children
+func (c *Codec) textKey() string {
+	if len(c.TextKey) == 0 {
+		return mxjTextKey
+	}
+	return c.TextKey
+}
+
+// encodeAttributes maps attribute and text keys in 'm' back to what mxj expects, so they are written as attributes
+// and text instead of child elements. When AttrsAsFields is set there is no way to tell attributes from elements,
+// and they are all written as elements.
+func (c *Codec) encodeAttributes(m map[string]interface{}) (map[string]interface{}, error) {
+	prefix := c.attrKey("")
+	text := c.textKey()
+	if (prefix == mxjAttrPrefix || len(prefix) == 0) && text == mxjTextKey {
+		return m, nil
+	}
+	result, err := renameKeys(m, func(key string) (string, bool) {
+		switch {
+		case key == text:
+			return mxjTextKey, true
+		case len(prefix) > 0 && len(key) > len(prefix) && strings.HasPrefix(key, prefix):
+			return mxjAttrPrefix + key[len(prefix):], true
+		}
+		return key, true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.(map[string]interface{}), nil
+}
@@ -0,0 +1,147 @@
+package xml
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"github.com/tsaikd/gogstash/config/goglog"
+	"github.com/tsaikd/gogstash/config/logevent"
+	"sync"
+	"time"
+)
+
+const (
+	itemTag         = "event"         // default element for each event in a batch
+	maxEvents       = 100             // default number of events in a batch
+	shutdownTimeout = 5 * time.Second // how long to wait for the output to take the last batch when the context is done
+)
+
+// batcher collects encoded events until they are written as one document
+type batcher struct {
+	mu       sync.Mutex
+	items    [][]byte        // encoded events waiting to be written
+	timer    *time.Timer     // flushes the batch after MaxWait
+	gen      uint64          // incremented on each flush, so a stale timer does not flush a newer batch
+	ctx      context.Context // context of the codec, the last batch is written when it is done
+	dataChan chan<- []byte   // where the last event should be written
+	shutdown time.Duration   // how long to wait for the output when ctx is done
+}
+
+// initBatch sets defaults for batching and writes the last batch when 'ctx' is done
+func (c *Codec) initBatch(ctx context.Context) {
+	if len(c.BatchRoot) == 0 {
+		return
+	}
+	if len(c.ItemTag) == 0 {
+		c.ItemTag = c.RootTag
+	}
+	if len(c.ItemTag) == 0 {
+		c.ItemTag = itemTag
+	}
+	if c.MaxEvents <= 0 {
+		c.MaxEvents = maxEvents
+	}
+	c.batch = &batcher{ctx: ctx, shutdown: shutdownTimeout}
+	go c.watch()
+}
+
+// encodeBatch adds 'event' to the current batch, the batch is written to 'dataChan' when it has MaxEvents events,
+// after MaxWait seconds or when the codec context is done. ok is true if a document was written.
+func (c *Codec) encodeBatch(ctx context.Context, event logevent.LogEvent, dataChan chan<- []byte) (ok bool, err error) {
+	item, err := c.marshal(event, c.Indent, c.ItemTag)
+	if err != nil {
+		return false, err
+	}
+	b := c.batch
+	b.mu.Lock()
+	b.dataChan = dataChan
+	b.items = append(b.items, item)
+	// after the codec context is done there is no one left to write the batch later
+	if len(b.items) >= c.MaxEvents || b.ctx.Err() != nil {
+		doc := c.flush()
+		b.mu.Unlock()
+		return b.send(ctx, doc, dataChan), nil
+	}
+	if len(b.items) == 1 && c.MaxWait > 0 {
+		gen := b.gen
+		b.timer = time.AfterFunc(time.Duration(c.MaxWait)*time.Second, func() { c.flushTimer(gen) })
+	}
+	b.mu.Unlock()
+	return false, nil
+}
+
+// flushTimer writes the batch when MaxWait has passed, unless batch 'gen' has already been written
+func (c *Codec) flushTimer(gen uint64) {
+	b := c.batch
+	b.mu.Lock()
+	if b.gen != gen {
+		b.mu.Unlock()
+		return
+	}
+	dataChan := b.dataChan
+	doc := c.flush()
+	b.mu.Unlock()
+	b.send(b.ctx, doc, dataChan)
+}
+
+// watch writes the last batch when the codec context is done
+func (c *Codec) watch() {
+	b := c.batch
+	<-b.ctx.Done()
+	b.mu.Lock()
+	dataChan := b.dataChan
+	doc := c.flush()
+	b.mu.Unlock()
+	b.send(b.ctx, doc, dataChan)
+}
+
+// send writes 'doc' to 'dataChan'. When 'ctx' is done the output gets the shutdown timeout to take the document,
+// after that it is dropped and logged. Returns true if the document was written.
+func (b *batcher) send(ctx context.Context, doc []byte, dataChan chan<- []byte) bool {
+	if doc == nil {
+		return false
+	}
+	select {
+	case dataChan <- doc:
+		return true
+	case <-ctx.Done():
+	}
+	select {
+	case dataChan <- doc:
+		return true
+	case <-time.After(b.shutdown):
+	}
+	goglog.Logger.Errorf("%s: batch of %d bytes dropped, it was not read within %s after the context was done", ModuleName, len(doc), b.shutdown)
+	return false
+}
+
+// flush returns the current batch as a document and starts a new batch, nil if the batch is empty.
+// The lock must be held.
+func (c *Codec) flush() []byte {
+	b := c.batch
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	b.gen++
+	if len(b.items) == 0 {
+		return nil
+	}
+	var buf bytes.Buffer
+	if c.Declaration {
+		buf.WriteString(xml.Header)
+	}
+	buf.WriteString("<" + c.BatchRoot + ">")
+	for _, item := range b.items {
+		if len(c.Indent) > 0 {
+			buf.WriteString("\n")
+		}
+		buf.Write(item)
+	}
+	if len(c.Indent) > 0 {
+		buf.WriteString("\n")
+	}
+	buf.WriteString("</" + c.BatchRoot + ">")
+	b.items = nil
+	return buf.Bytes()
+}
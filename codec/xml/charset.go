@@ -0,0 +1,70 @@
+package xml
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/ianaindex"
+	"golang.org/x/text/encoding/unicode"
+	"io"
+)
+
+// checkCharset validates the charset configuration
+func (c *Codec) checkCharset() error {
+	if len(c.Charset) == 0 {
+		return nil
+	}
+	_, err := lookupCharset(c.Charset)
+	return err
+}
+
+// lookupCharset returns the encoding for 'label', using IANA names first and then the names used by browsers
+func lookupCharset(label string) (encoding.Encoding, error) {
+	if e, err := ianaindex.IANA.Encoding(label); err == nil && e != nil {
+		return e, nil
+	}
+	e, err := htmlindex.Get(label)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported charset %q", label)
+	}
+	return e, nil
+}
+
+// charsetReader is used by the xml decoder for documents declaring an encoding other than UTF-8
+func charsetReader(label string, input io.Reader) (io.Reader, error) {
+	e, err := lookupCharset(label)
+	if err != nil {
+		return nil, err
+	}
+	return e.NewDecoder().Reader(input), nil
+}
+
+// toUTF8 converts 'r' to UTF-8 if Charset is set or the document is UTF-16. UTF-16 is detected from the BOM, or
+// from how "<?" is encoded when there is no BOM. Returns true if 'r' was converted and the encoding in the XML
+// declaration should be ignored.
+func (c *Codec) toUTF8(r io.Reader) (io.Reader, bool) {
+	if len(c.Charset) > 0 {
+		e, err := lookupCharset(c.Charset)
+		if err == nil {
+			return e.NewDecoder().Reader(r), true
+		}
+	}
+	br := bufio.NewReader(r)
+	head, _ := br.Peek(4)
+	var e encoding.Encoding
+	switch {
+	case bytes.HasPrefix(head, []byte{0xfe, 0xff}):
+		e = unicode.UTF16(unicode.BigEndian, unicode.ExpectBOM)
+	case bytes.HasPrefix(head, []byte{0xff, 0xfe}):
+		e = unicode.UTF16(unicode.LittleEndian, unicode.ExpectBOM)
+	case bytes.Equal(head, []byte{0, '<', 0, '?'}):
+		e = unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM)
+	case bytes.Equal(head, []byte{'<', 0, '?', 0}):
+		e = unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM)
+	default:
+		return br, false
+	}
+	return e.NewDecoder().Reader(br), true
+}
@@ -3,6 +3,7 @@ package xml
 import (
 	"context"
 	"errors"
+	"fmt"
 	mjx "github.com/clbanning/mxj/v2"
 	"github.com/tsaikd/gogstash/config"
 	"github.com/tsaikd/gogstash/config/logevent"
@@ -15,74 +16,289 @@ const ModuleName = "xml"
 // ErrorTag tag added to event when process module failed
 const ErrorTag = "gogstash_codec_xml_error"
 
+const ErrorField = "xml_error" // default field for the parser error
+
+// Error modes
+const (
+	OnErrorDrop = "drop" // return the error and drop the data, default
+	OnErrorTag  = "tag"  // send an event with the data in message, the error in ErrorField and ErrorTag
+)
+
 var NotImplementedError = errors.New("not implemented")
 
+var errUnsupportedInput = errors.New("unsupported input format")
+
 // Codec default struct for XML
 type Codec struct {
 	config.CodecConfig
-	TryCast bool   `json:"try_cast" yaml:"try_cast"` // attempt to cast types from string
-	RootTag string `json:"root_tag" yaml:"root_tag"` // root tag on encoder
+	TryCast   bool   `json:"try_cast" yaml:"try_cast"`     // attempt to cast types from string
+	RootTag   string `json:"root_tag" yaml:"root_tag"`     // root tag on encoder
+	Target    string `json:"target" yaml:"target"`         // field to store the decoded document in, empty for top level
+	SplitPath string `json:"split_path" yaml:"split_path"` // path to a repeated element, each becomes an event
+
+	Fields        map[string]string `json:"fields" yaml:"fields"`                 // event field -> path in document, only these are kept if set
+	DocumentField string            `json:"document_field" yaml:"document_field"` // field to keep the full document in when Fields is used
+
+	Namespaces   string            `json:"namespaces" yaml:"namespaces"`       // namespace handling, one of strip, keep or map
+	NamespaceMap map[string]string `json:"namespace_map" yaml:"namespace_map"` // namespace URI -> prefix, used with map
+
+	AttrPrefix    string `json:"attr_prefix" yaml:"attr_prefix"`         // prefix for attribute names, default "-"
+	TextKey       string `json:"text_key" yaml:"text_key"`               // key for text in elements with attributes or children, default "#text"
+	AttrsAsFields bool   `json:"attrs_as_fields" yaml:"attrs_as_fields"` // store attributes without prefix, as if they were child elements
+
+	Types map[string]string `json:"types" yaml:"types"` // path -> int, float, bool, string or time:<layout>, TryCast is used for other paths
+
+	ForceArray   []string `json:"force_array" yaml:"force_array"`     // paths to elements that are always decoded as a list
+	UnwrapArrays bool     `json:"unwrap_arrays" yaml:"unwrap_arrays"` // on encode, write single element lists at ForceArray paths as a single value
+
+	TimestampPath    string   `json:"timestamp_path" yaml:"timestamp_path"`       // path to the event time in the document, empty to use current time
+	TimestampLayouts []string `json:"timestamp_layouts" yaml:"timestamp_layouts"` // layouts to try, Go layouts, names like RFC3339, UNIX or UNIX_MS
+	Timezone         string   `json:"timezone" yaml:"timezone"`                   // timezone for decoded timestamps without zone and for timestamp_format, default UTC
+
+	OnError    string `json:"on_error" yaml:"on_error"`       // what to do when decoding fails, drop or tag
+	ErrorField string `json:"error_field" yaml:"error_field"` // field for the parser error when OnError is tag
+
+	MaxBytes     int64 `json:"max_bytes" yaml:"max_bytes"`         // max size of a document, 0 for no limit
+	MaxDepth     int   `json:"max_depth" yaml:"max_depth"`         // max nesting of elements, 0 for no limit
+	MaxElements  int   `json:"max_elements" yaml:"max_elements"`   // max number of elements in a document (or split element), 0 for no limit
+	AllowDoctype bool  `json:"allow_doctype" yaml:"allow_doctype"` // accept documents with a DOCTYPE declaration
+
+	Charset string `json:"charset" yaml:"charset"` // charset of incoming documents, overrides the XML declaration
+
+	Declaration     bool     `json:"declaration" yaml:"declaration"`           // start encoded documents with a XML declaration
+	Indent          string   `json:"indent" yaml:"indent"`                     // indent encoded documents with this string, empty for no indent
+	Include         []string `json:"include" yaml:"include"`                   // event fields to encode, empty for all
+	Exclude         []string `json:"exclude" yaml:"exclude"`                   // event fields not to encode
+	RootAttributes  []string `json:"root_attributes" yaml:"root_attributes"`   // event fields to write as attributes on the root element
+	TimestampKey    string   `json:"timestamp_key" yaml:"timestamp_key"`       // element for @timestamp, default timestamp
+	TimestampFormat string   `json:"timestamp_format" yaml:"timestamp_format"` // layout for @timestamp, default RFC3339 in UTC
+	TagsMode        string   `json:"tags_mode" yaml:"tags_mode"`               // how tags are written, repeat, join or nested
+
+	BatchRoot string `json:"batch_root" yaml:"batch_root"` // root element when encoding several events in one document, empty to encode each event alone
+	ItemTag   string `json:"item_tag" yaml:"item_tag"`     // element for each event in a batch, default root_tag or event
+	MaxEvents int    `json:"max_events" yaml:"max_events"` // max number of events in a batch
+	MaxWait   int    `json:"max_wait" yaml:"max_wait"`     // max number of seconds to wait before a batch is written, 0 to wait for max_events
+
+	Profile         string   `json:"profile" yaml:"profile"`                     // normalize well known documents, windows_event or soap
+	SoapHeaders     []string `json:"soap_headers" yaml:"soap_headers"`           // SOAP header elements to keep, empty for all
+	SoapHeaderField string   `json:"soap_header_field" yaml:"soap_header_field"` // field for SOAP header elements
+
+	Xsd           string `json:"xsd" yaml:"xsd"`                         // XML schema file to validate incoming documents against, empty for no validation
+	XsdMaxErrors  int    `json:"xsd_max_errors" yaml:"xsd_max_errors"`   // max number of violations to report
+	XsdErrorField string `json:"xsd_error_field" yaml:"xsd_error_field"` // field for the violations
+	XsdReject     bool   `json:"xsd_reject" yaml:"xsd_reject"`           // handle invalid documents as decoding errors (see OnError) instead of tagging them
+
+	location *time.Location // parsed Timezone
+	batch    *batcher       // current batch, when BatchRoot is set
+	schema   *xsdSchema     // loaded Xsd
 }
 
 // InitHandler initialize the codec plugin
-func InitHandler(_ context.Context, raw config.ConfigRaw) (config.TypeCodecConfig, error) {
+func InitHandler(ctx context.Context, raw config.ConfigRaw) (config.TypeCodecConfig, error) {
 	c := &Codec{
 		CodecConfig: config.CodecConfig{
 			CommonConfig: config.CommonConfig{
 				Type: ModuleName,
 			},
 		},
+		OnError:         OnErrorDrop,
+		ErrorField:      ErrorField,
+		AllowDoctype:    true,
+		SoapHeaderField: SoapHeaderField,
+		XsdMaxErrors:    xsdMaxErrors,
+		XsdErrorField:   XsdErrorField,
+	}
+	if err := config.ReflectConfig(raw, c); err != nil {
+		return nil, err
 	}
-	if res, ok := (raw)["try_cast"].(bool); ok {
-		c.TryCast = res
+	if err := c.checkNamespaces(); err != nil {
+		return nil, err
 	}
-	if res, ok := (raw)["root_tag"].(string); ok {
-		c.RootTag = res
+	if err := c.checkTypes(); err != nil {
+		return nil, err
 	}
+	if err := c.initTimestamp(); err != nil {
+		return nil, err
+	}
+	if err := c.checkCharset(); err != nil {
+		return nil, err
+	}
+	if err := c.checkEncoder(); err != nil {
+		return nil, err
+	}
+	if err := c.checkProfile(); err != nil {
+		return nil, err
+	}
+	if err := c.loadSchema(); err != nil {
+		return nil, err
+	}
+	switch c.OnError {
+	case OnErrorDrop, OnErrorTag:
+	default:
+		return nil, fmt.Errorf("invalid on_error %q", c.OnError)
+	}
+	c.initBatch(ctx)
 	return c, nil
 }
 
+// parse turns 'data' into a map, and returns tags and fields to add to the event
+func (c *Codec) parse(data interface{}) (m mjx.Map, r report, err error) {
+	reader, err := c.newReader(data)
+	if err != nil {
+		return nil, r, err
+	}
+	d := c.newDecoder(reader)
+	start, err := d.root()
+	if err != nil {
+		return nil, r, err
+	}
+	name := d.name(start.Name)
+	d.validate(start.Name.Local, false)
+	value, err := d.element(start, name)
+	if err == nil {
+		err = d.finishValidation()
+	}
+	if err != nil {
+		return nil, r, err
+	}
+	return mjx.Map{name: value}, d.report, nil
+}
+
+// merge adds the decoded document, tags and fields to the event, the document either under Target or at the top level.
+// Existing fields at the top level are not overwritten. Keys are set in Extra as they are, so root elements named like
+// the built-in fields message, tags or @timestamp are kept in Extra.
+func (c *Codec) merge(m mjx.Map, r report, event *logevent.LogEvent) {
+	event.AddTag(r.tags...)
+	for field, value := range r.fields {
+		event.SetValue(field, value)
+	}
+	m, tags := c.applyProfile(m)
+	event.AddTag(tags...)
+	if len(c.TimestampPath) > 0 {
+		if t, err := c.timestamp(m); err == nil {
+			event.Timestamp = t
+		} else {
+			event.AddTag(TimestampErrorTag)
+		}
+	}
+	if len(c.Fields) > 0 {
+		m = c.extract(m)
+	}
+	if len(c.Target) > 0 {
+		event.SetValue(c.Target, map[string]interface{}(m))
+		return
+	}
+	if event.Extra == nil {
+		event.Extra = make(map[string]interface{})
+	}
+	for k, v := range m {
+		if _, ok := event.Extra[k]; !ok {
+			event.Extra[k] = v
+		}
+	}
+}
+
 // Decode returns an event from 'data' as XML format
 func (c *Codec) Decode(_ context.Context, data interface{}, eventExtra map[string]interface{}, tags []string, msgChan chan<- logevent.LogEvent) (ok bool, err error) {
+	if len(c.SplitPath) > 0 {
+		return c.decodeSplit(data, eventExtra, tags, msgChan)
+	}
 	event := logevent.LogEvent{
 		Timestamp: time.Now(),
-		Extra:     eventExtra,
+		Extra:     copyExtra(eventExtra),
 	}
 	event.AddTag(tags...)
 	// identify incoming message
-	var m mjx.Map
-	switch data.(type) {
-	case string:
-		m, err = mjx.NewMapXml([]byte(data.(string)), c.TryCast)
-	case []byte:
-		m, err = mjx.NewMapXml(data.([]byte), c.TryCast)
-	default:
-		err = errors.New("unsupported input format")
-	}
+	m, r, err := c.parse(data)
 	if err != nil {
+		return c.decodeError(data, err, event, msgChan)
+	}
+	c.merge(m, r, &event)
+	msgChan <- event
+	return true, nil
+}
+
+// decodeError handles 'err' from decoding 'data' according to OnError
+func (c *Codec) decodeError(data interface{}, err error, event logevent.LogEvent, msgChan chan<- logevent.LogEvent) (ok bool, _ error) {
+	if c.OnError != OnErrorTag {
 		return false, err
 	}
-	event.Extra = m
+	c.setError(data, err, &event)
 	msgChan <- event
 	return true, nil
 }
 
-// DecodeEvent decodes 'data' as XML format to event
-func (c *Codec) DecodeEvent(data []byte, event *logevent.LogEvent) (err error) {
-	return NotImplementedError
+// setError adds the raw 'data' and 'err' to the event
+func (c *Codec) setError(data interface{}, err error, event *logevent.LogEvent) {
+	switch v := data.(type) {
+	case string:
+		event.Message = v
+	case []byte:
+		event.Message = string(v)
+	}
+	event.SetValue(c.ErrorField, err.Error())
+	event.AddTag(ErrorTag)
 }
 
-// Encode encodes the event to a XML encoded message
-func (c *Codec) Encode(_ context.Context, event logevent.LogEvent, dataChan chan<- []byte) (ok bool, err error) {
-	json, err := event.MarshalJSON()
+// decodeSplit sends one event for each element found at SplitPath
+func (c *Codec) decodeSplit(data interface{}, eventExtra map[string]interface{}, tags []string, msgChan chan<- logevent.LogEvent) (ok bool, err error) {
+	newEvent := func() logevent.LogEvent {
+		event := logevent.LogEvent{
+			Timestamp: time.Now(),
+			Extra:     copyExtra(eventExtra),
+		}
+		event.AddTag(tags...)
+		return event
+	}
+	reader, err := c.newReader(data)
+	if err == nil {
+		err = c.split(reader, func(m mjx.Map, r report, err error) {
+			event := newEvent()
+			if err != nil {
+				// the element failed validation with XsdReject
+				if c.OnError != OnErrorTag {
+					return
+				}
+				c.setError(nil, err, &event)
+				msgChan <- event
+				ok = true
+				return
+			}
+			c.merge(m, r, &event)
+			msgChan <- event
+			ok = true
+		})
+	}
 	if err != nil {
-		return false, err
+		sent, err := c.decodeError(data, err, newEvent(), msgChan)
+		return ok || sent, err
+	}
+	return ok, nil
+}
+
+// DecodeEvent decodes 'data' as XML format to event
+func (c *Codec) DecodeEvent(data []byte, event *logevent.LogEvent) (err error) {
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
 	}
-	m, err := mjx.NewMapJson(json)
+	m, r, err := c.parse(data)
 	if err != nil {
-		return false, err
+		if c.OnError != OnErrorTag {
+			return err
+		}
+		c.setError(data, err, event)
+		return nil
+	}
+	c.merge(m, r, event)
+	return nil
+}
+
+// Encode encodes the event to a XML encoded message
+func (c *Codec) Encode(ctx context.Context, event logevent.LogEvent, dataChan chan<- []byte) (ok bool, err error) {
+	if c.batch != nil {
+		return c.encodeBatch(ctx, event, dataChan)
 	}
-	output, err := m.Xml(c.RootTag)
+	output, err := c.encode(event)
 	if err != nil {
 		return false, err
 	}
@@ -0,0 +1,835 @@
+package xml
+
+import (
+	"context"
+	"errors"
+	mjx "github.com/clbanning/mxj/v2"
+	"github.com/tsaikd/gogstash/config"
+	"github.com/tsaikd/gogstash/config/logevent"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testDocument = `<order id="42"><customer>ACME</customer><item>nut</item><item>bolt</item></order>`
+
+func TestCodec_DecodeEvent(t *testing.T) {
+	c := Codec{}
+	event := logevent.LogEvent{
+		Timestamp: time.Now(),
+	}
+	event.SetValue("order", "keep me")
+	err := c.DecodeEvent([]byte(testDocument), &event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.GetString("order") != "keep me" {
+		t.Error("existing field was overwritten")
+	}
+	// decode under a target
+	c.Target = "xml"
+	err = c.DecodeEvent([]byte(testDocument), &event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.GetString("xml.order.customer") != "ACME" {
+		t.Errorf("expected customer ACME, got %v", event.Get("xml.order.customer"))
+	}
+	if items, ok := event.Get("xml.order.item").([]interface{}); !ok || len(items) != 2 {
+		t.Errorf("expected two items, got %v", event.Get("xml.order.item"))
+	}
+	// invalid document
+	err = c.DecodeEvent([]byte("<order>"), &event)
+	if err == nil {
+		t.Error("invalid document did not return error")
+	}
+}
+
+func TestCodec_Baseline(t *testing.T) {
+	// with no options set documents are decoded as the baseline codec did with mxj
+	docs := []string{
+		`<a>1</a>`,
+		`<a><b>x</b><b>y</b><c/></a>`,
+		`<a id="1">text</a>`,
+		`<a id="1"><b>2</b>tail</a>`,
+		`<a>  spaced  </a>`,
+		`<a><b>1.5</b><c>true</c><d>-3</d><e>0x10</e><f>1e3</f><g>007</g></a>`,
+		`<ns:a xmlns:ns="urn:x"><ns:b>1</ns:b></ns:a>`,
+		`<a xmlns="urn:x"><b>1</b></a>`,
+		`<a x:y="1" xmlns:x="urn:x"/>`,
+		`<a><![CDATA[<x>]]></a>`,
+		`<?xml version="1.0"?><!-- c --><a><b/><b>1</b></a>`,
+		`<a b=""><c></c></a>`,
+		`<a>&amp;&lt;</a>`,
+	}
+	for _, cast := range []bool{false, true} {
+		c := Codec{TryCast: cast}
+		for _, doc := range docs {
+			want, err := mjx.NewMapXml([]byte(doc), cast)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, _, err := c.parse(doc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("try_cast %v, %s: expected %v, got %v", cast, doc, want, got)
+			}
+		}
+	}
+	// mxj keeps only the text before the first child element in mixed content, all text is kept
+	got, _, err := (&Codec{}).parse(`<a>x<b/>y</a>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text := got["a"].(map[string]interface{})[mxjTextKey]; text != "xy" {
+		t.Errorf("expected text xy, got %v", text)
+	}
+}
+
+func TestCodec_DecodeExtra(t *testing.T) {
+	c := Codec{}
+	extra := map[string]interface{}{"host": "x"}
+	msgChan := make(chan logevent.LogEvent, 2)
+	for _, doc := range []string{"<a>1</a>", "<b>2</b>"} {
+		if ok, err := c.Decode(context.Background(), doc, extra, nil, msgChan); !ok || err != nil {
+			t.Fatalf("decode failed: %v", err)
+		}
+	}
+	first, second := <-msgChan, <-msgChan
+	if first.Get("b") != nil || second.Get("a") != nil {
+		t.Errorf("fields leaked between events: %v and %v", first.Extra, second.Extra)
+	}
+	if first.GetString("host") != "x" || second.GetString("host") != "x" {
+		t.Errorf("extra field missing: %v and %v", first.Extra, second.Extra)
+	}
+	if len(extra) != 1 {
+		t.Errorf("caller's extra map was changed: %v", extra)
+	}
+}
+
+func TestCodec_DecodeReserved(t *testing.T) {
+	c := Codec{}
+	msgChan := make(chan logevent.LogEvent, 2)
+	for _, doc := range []string{"<message>hello</message>", "<tags><tag>a</tag></tags>"} {
+		if ok, err := c.Decode(context.Background(), doc, nil, nil, msgChan); !ok || err != nil {
+			t.Fatalf("decode failed: %v", err)
+		}
+	}
+	// root elements named like built-in fields are kept in Extra
+	first, second := <-msgChan, <-msgChan
+	if first.Extra["message"] != "hello" || first.Message != "" {
+		t.Errorf("message element dropped: %q %v", first.Message, first.Extra)
+	}
+	if second.Extra["tags"] == nil || len(second.Tags) > 0 {
+		t.Errorf("tags element dropped: %v %v", second.Tags, second.Extra)
+	}
+}
+
+func TestCodec_Split(t *testing.T) {
+	c := Codec{SplitPath: "records.record", TryCast: true}
+	const doc = `<?xml version="1.0"?><records><header><record>skip</record></header><record id="1"><name>a</name></record><record id="2"><name>b</name></record></records>`
+	msgChan := make(chan logevent.LogEvent, 10)
+	ok, err := c.Decode(context.Background(), doc, map[string]interface{}{"source": "test"}, nil, msgChan)
+	if !ok || err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	close(msgChan)
+	var ids []interface{}
+	for event := range msgChan {
+		if event.GetString("source") != "test" {
+			t.Error("extra field missing")
+		}
+		ids = append(ids, event.Get("record.-id"))
+	}
+	if len(ids) != 2 || ids[0] != float64(1) || ids[1] != float64(2) {
+		t.Errorf("expected records 1 and 2, got %v", ids)
+	}
+}
+
+func TestCodec_Fields(t *testing.T) {
+	c := Codec{
+		Fields: map[string]string{
+			"order_id": "order.-id",
+			"items":    "order.item",
+			"missing":  "order.none",
+		},
+		DocumentField: "document",
+	}
+	var event logevent.LogEvent
+	err := c.DecodeEvent([]byte(testDocument), &event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.GetString("order_id") != "42" {
+		t.Errorf("expected order_id 42, got %v", event.Get("order_id"))
+	}
+	if items, ok := event.Get("items").([]interface{}); !ok || len(items) != 2 {
+		t.Errorf("expected two items, got %v", event.Get("items"))
+	}
+	if event.Get("missing") != nil || event.Get("order") != nil {
+		t.Error("unexpected fields in event")
+	}
+	if event.GetString("document.order.customer") != "ACME" {
+		t.Error("full document not kept")
+	}
+}
+
+func TestCodec_Namespaces(t *testing.T) {
+	const doc = `<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" xmlns:a="urn:a" xmlns:b="urn:b"><s:Body><a:id>1</a:id><b:id>2</b:id></s:Body></s:Envelope>`
+	tests := []struct {
+		mode string
+		path string
+		want string
+	}{
+		{NamespaceStrip, "Envelope.Body.id", ""},
+		{NamespaceKeep, "s:Envelope.s:Body.b:id", "2"},
+		{NamespaceKeep, "s:Envelope.-xmlns:a", "urn:a"},
+		{NamespaceMap, "soap:Envelope.soap:Body.first:id", "1"},
+	}
+	for _, tt := range tests {
+		c := Codec{
+			Namespaces:   tt.mode,
+			NamespaceMap: map[string]string{"http://schemas.xmlsoap.org/soap/envelope/": "soap", "urn:a": "first"},
+		}
+		m, _, err := c.parse(doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		values, _ := m.ValuesForPath(tt.path)
+		switch {
+		case len(tt.want) == 0 && len(values) != 2:
+			t.Errorf("%s: expected colliding names to give a list, got %v", tt.mode, values)
+		case len(tt.want) > 0 && (len(values) != 1 || values[0] != tt.want):
+			t.Errorf("%s: expected %s at %s, got %v", tt.mode, tt.want, tt.path, values)
+		}
+	}
+}
+
+func TestCodec_EncodeNamespaces(t *testing.T) {
+	event := logevent.LogEvent{}
+	event.SetValue("url:path", "/index")
+	// keys are only changed when a namespace mode is set
+	output, err := (&Codec{RootTag: "doc"}).encode(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(output), "<url:path>/index</url:path>") {
+		t.Errorf("field was renamed: %s", output)
+	}
+	output, err = (&Codec{RootTag: "doc", Namespaces: NamespaceStrip}).encode(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(output), "<path>/index</path>") {
+		t.Errorf("prefix was not stripped: %s", output)
+	}
+	// fields that get the same name are an error, not a random pick
+	event.SetValue("other:path", "/other")
+	if _, err = (&Codec{RootTag: "doc", Namespaces: NamespaceStrip}).encode(event); err == nil {
+		t.Error("expected error for colliding fields")
+	}
+}
+
+func TestCodec_Attributes(t *testing.T) {
+	c := Codec{AttrPrefix: "attr_", TextKey: "value", RootTag: "doc"}
+	m, _, err := c.parse(`<order id="42"><note lang="en">hello</note></order>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if values, _ := m.ValuesForPath("order.attr_id"); len(values) != 1 || values[0] != "42" {
+		t.Errorf("expected attr_id, got %v", m)
+	}
+	if values, _ := m.ValuesForPath("order.note.value"); len(values) != 1 || values[0] != "hello" {
+		t.Errorf("expected note value, got %v", m)
+	}
+	// encode back and make sure the attributes are still attributes
+	dataChan := make(chan []byte, 1)
+	_, err = c.Encode(context.Background(), logevent.LogEvent{Extra: m}, dataChan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	output := string(<-dataChan)
+	if !strings.Contains(output, `<order id="42">`) || !strings.Contains(output, `<note lang="en">hello</note>`) {
+		t.Errorf("unexpected output %s", output)
+	}
+	// attributes as fields
+	c = Codec{AttrsAsFields: true}
+	m, _, err = c.parse(`<order id="42"/>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if values, _ := m.ValuesForPath("order.id"); len(values) != 1 {
+		t.Errorf("expected id field, got %v", m)
+	}
+}
+
+func TestCodec_Types(t *testing.T) {
+	c := Codec{
+		TryCast: true,
+		Types: map[string]string{
+			"order.zip":     "string",
+			"order.-id":     "int",
+			"order.created": "time:RFC3339",
+			"order.count":   "int",
+		},
+	}
+	if err := c.checkTypes(); err != nil {
+		t.Fatal(err)
+	}
+	m, r, err := c.parse(`<order id="42"><zip>0150</zip><created>2023-03-30T10:00:00Z</created><count>many</count><price>9.5</price></order>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	order := m["order"].(map[string]interface{})
+	if order["zip"] != "0150" {
+		t.Errorf("expected zip as string, got %v", order["zip"])
+	}
+	if order["-id"] != int64(42) {
+		t.Errorf("expected id as int, got %T", order["-id"])
+	}
+	if _, ok := order["created"].(time.Time); !ok {
+		t.Errorf("expected created as time, got %T", order["created"])
+	}
+	if order["price"] != 9.5 {
+		t.Errorf("expected price from try_cast, got %v", order["price"])
+	}
+	if order["count"] != "many" || len(r.tags) != 1 || r.tags[0] != CastErrorTag {
+		t.Errorf("expected failed cast to be tagged, got %v %v", order["count"], r.tags)
+	}
+	c.Types["order"] = "date"
+	if c.checkTypes() == nil {
+		t.Error("invalid type was accepted")
+	}
+}
+
+func TestCodec_ForceArray(t *testing.T) {
+	c := Codec{ForceArray: []string{"order.item", "order.customer"}}
+	m, _, err := c.parse(testDocument)
+	if err != nil {
+		t.Fatal(err)
+	}
+	order := m["order"].(map[string]interface{})
+	if list, ok := order["customer"].([]interface{}); !ok || len(list) != 1 {
+		t.Errorf("expected customer as list, got %v", order["customer"])
+	}
+	if list, ok := order["item"].([]interface{}); !ok || len(list) != 2 {
+		t.Errorf("expected two items, got %v", order["item"])
+	}
+	c.unwrapArrays(m)
+	if order["customer"] != "ACME" {
+		t.Errorf("expected customer to be unwrapped, got %v", order["customer"])
+	}
+	if list, ok := order["item"].([]interface{}); !ok || len(list) != 2 {
+		t.Errorf("expected items to be kept, got %v", order["item"])
+	}
+}
+
+func TestCodec_Timestamp(t *testing.T) {
+	c := Codec{
+		TimestampPath:    "event.time",
+		TimestampLayouts: []string{"02.01.2006 15:04", LayoutUnixMS},
+		Timezone:         "Europe/Oslo",
+	}
+	if err := c.initTimestamp(); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		doc  string
+		want time.Time
+	}{
+		{"<event><time>30.03.2023 10:00</time></event>", time.Date(2023, 3, 30, 8, 0, 0, 0, time.UTC)},
+		{"<event><time>1680163200500</time></event>", time.Date(2023, 3, 30, 8, 0, 0, 500000000, time.UTC)},
+	}
+	for _, tt := range tests {
+		var event logevent.LogEvent
+		if err := c.DecodeEvent([]byte(tt.doc), &event); err != nil {
+			t.Fatal(err)
+		}
+		if !event.Timestamp.Equal(tt.want) {
+			t.Errorf("expected %v, got %v", tt.want, event.Timestamp)
+		}
+	}
+	var event logevent.LogEvent
+	if err := c.DecodeEvent([]byte("<event><time>yesterday</time></event>"), &event); err != nil {
+		t.Fatal(err)
+	}
+	if event.Timestamp.IsZero() || len(event.Tags) != 1 || event.Tags[0] != TimestampErrorTag {
+		t.Errorf("expected current time and error tag, got %v %v", event.Timestamp, event.Tags)
+	}
+}
+
+func TestCodec_OnError(t *testing.T) {
+	c := Codec{OnError: OnErrorTag, ErrorField: ErrorField}
+	msgChan := make(chan logevent.LogEvent, 1)
+	ok, err := c.Decode(context.Background(), "<order><id>1</order>", nil, nil, msgChan)
+	if !ok || err != nil {
+		t.Fatalf("expected event to be sent, got %v %v", ok, err)
+	}
+	event := <-msgChan
+	if event.Message != "<order><id>1</order>" || len(event.GetString(ErrorField)) == 0 || len(event.Tags) != 1 || event.Tags[0] != ErrorTag {
+		t.Errorf("unexpected error event %v", event)
+	}
+	c.OnError = OnErrorDrop
+	ok, err = c.Decode(context.Background(), "<order>", nil, nil, msgChan)
+	if ok || err == nil {
+		t.Error("expected error to be returned")
+	}
+}
+
+func TestCodec_Limits(t *testing.T) {
+	const doc = `<a><b><c>1</c><c>2</c></b></a>`
+	tests := []struct {
+		name string
+		c    Codec
+		data interface{}
+		want error
+	}{
+		{"no limits", Codec{AllowDoctype: true}, doc, nil},
+		{"max_bytes", Codec{MaxBytes: 10}, doc, errMaxBytes},
+		{"max_bytes reader", Codec{MaxBytes: 10}, strings.NewReader(doc), errMaxBytes},
+		{"max_depth", Codec{MaxDepth: 2}, doc, errMaxDepth},
+		{"max_elements", Codec{MaxElements: 3}, doc, errMaxElements},
+		{"doctype", Codec{}, `<!DOCTYPE a [<!ENTITY x "y">]>` + doc, errDoctype},
+		{"doctype allowed", Codec{AllowDoctype: true}, `<!DOCTYPE a>` + doc, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := tt.c.parse(tt.data)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+	// DOCTYPE is allowed with the defaults from InitHandler
+	c, err := InitHandler(context.Background(), config.ConfigRaw{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = c.(*Codec).parse(`<!DOCTYPE a>` + doc); err != nil {
+		t.Errorf("expected DOCTYPE to be allowed by default, got %v", err)
+	}
+}
+
+func TestCodec_Charset(t *testing.T) {
+	utf16le := []byte{0xff, 0xfe}
+	for _, r := range `<?xml version="1.0" encoding="UTF-16"?><name>Ærø</name>` {
+		utf16le = append(utf16le, byte(r), byte(r>>8))
+	}
+	tests := []struct {
+		name string
+		c    Codec
+		data []byte
+	}{
+		{"latin1", Codec{}, []byte("<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?><name>\xc6r\xf8</name>")},
+		{"windows-1252", Codec{}, []byte("<?xml version=\"1.0\" encoding=\"windows-1252\"?><name>\xc6r\xf8</name>")},
+		{"override", Codec{Charset: "latin1"}, []byte("<?xml version=\"1.0\" encoding=\"UTF-8\"?><name>\xc6r\xf8</name>")},
+		{"utf-16le", Codec{}, utf16le},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, _, err := tt.c.parse(tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if m["name"] != "Ærø" {
+				t.Errorf("expected Ærø, got %v", m["name"])
+			}
+		})
+	}
+}
+
+func TestCodec_Encode(t *testing.T) {
+	c := Codec{
+		RootTag:         "event",
+		Declaration:     true,
+		Exclude:         []string{"secret"},
+		RootAttributes:  []string{"id"},
+		TimestampFormat: "2006-01-02",
+		TagsMode:        TagsNested,
+	}
+	event := logevent.LogEvent{
+		Timestamp: time.Date(2023, 3, 30, 10, 0, 0, 0, time.UTC),
+		Message:   "hello",
+		Tags:      []string{"a", "b"},
+	}
+	event.SetValue("id", "42")
+	event.SetValue("secret", "password")
+	output, err := c.encode(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const want = `<?xml version="1.0" encoding="UTF-8"?>` + "\n" + `<event id="42"><message>hello</message><tags><tag>a</tag><tag>b</tag></tags><timestamp>2023-03-30</timestamp></event>`
+	if string(output) != want {
+		t.Errorf("expected %s, got %s", want, output)
+	}
+}
+
+func TestCodec_EncodeTimestamp(t *testing.T) {
+	event := logevent.LogEvent{Timestamp: time.Date(2023, 3, 30, 1, 0, 0, 0, time.FixedZone("CET", 3600))}
+	tests := []struct {
+		timezone string
+		want     string
+	}{
+		{"", "2023-03-30 00:00"},
+		{"America/New_York", "2023-03-29 20:00"},
+	}
+	for _, tt := range tests {
+		c := Codec{TimestampFormat: "2006-01-02 15:04", Timezone: tt.timezone}
+		if err := c.initTimestamp(); err != nil {
+			t.Fatal(err)
+		}
+		if got := c.formatTimestamp(event); got != tt.want {
+			t.Errorf("%q: expected %s, got %s", tt.timezone, tt.want, got)
+		}
+	}
+}
+
+func TestCodec_Batch(t *testing.T) {
+	c := Codec{BatchRoot: "batch", MaxEvents: 2, Include: []string{"id"}}
+	ctx, cancel := context.WithCancel(context.Background())
+	c.initBatch(ctx)
+	dataChan := make(chan []byte, 2)
+	for i := 0; i < 3; i++ {
+		event := logevent.LogEvent{}
+		event.SetValue("id", i)
+		ok, err := c.Encode(ctx, event, dataChan)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// only the event completing the batch writes a document
+		if ok != (i == 1) {
+			t.Errorf("event %d: unexpected ok %v", i, ok)
+		}
+	}
+	const first = `<batch><event><id>0</id></event><event><id>1</id></event></batch>`
+	if output := string(<-dataChan); output != first {
+		t.Errorf("expected %s, got %s", first, output)
+	}
+	// the last event is written when the context is done
+	cancel()
+	const last = `<batch><event><id>2</id></event></batch>`
+	select {
+	case output := <-dataChan:
+		if string(output) != last {
+			t.Errorf("expected %s, got %s", last, output)
+		}
+	case <-time.After(time.Second):
+		t.Error("batch was not written on cancel")
+	}
+}
+
+func TestCodec_BatchSlowOutput(t *testing.T) {
+	c := Codec{BatchRoot: "batch", MaxEvents: 10}
+	ctx, cancel := context.WithCancel(context.Background())
+	c.initBatch(ctx)
+	dataChan := make(chan []byte)
+	if _, err := c.Encode(ctx, logevent.LogEvent{Message: "test"}, dataChan); err != nil {
+		t.Fatal(err)
+	}
+	// the output is busy when the context is done, the last batch must still be written
+	cancel()
+	time.Sleep(100 * time.Millisecond)
+	select {
+	case output := <-dataChan:
+		if !strings.Contains(string(output), "<message>test</message>") {
+			t.Errorf("unexpected batch %s", output)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("last batch was not written")
+	}
+}
+
+func TestCodec_BatchDone(t *testing.T) {
+	c := Codec{BatchRoot: "batch", MaxEvents: 10}
+	ctx, cancel := context.WithCancel(context.Background())
+	c.initBatch(ctx)
+	c.batch.shutdown = 50 * time.Millisecond
+	cancel()
+	// nobody reads the channel, the batch is written at once after the context is done and dropped after the timeout
+	result := make(chan bool)
+	go func() {
+		ok, _ := c.Encode(ctx, logevent.LogEvent{Message: "test"}, make(chan []byte))
+		result <- ok
+	}()
+	select {
+	case ok := <-result:
+		if ok {
+			t.Error("expected ok false when the batch was not written")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("encoder blocked on a done context")
+	}
+}
+
+func TestCodec_BatchStaleTimer(t *testing.T) {
+	c := Codec{BatchRoot: "batch", MaxEvents: 2, MaxWait: 1, Include: []string{"id"}}
+	c.initBatch(context.Background())
+	dataChan := make(chan []byte, 2)
+	event := logevent.LogEvent{}
+	event.SetValue("id", 1)
+	if _, err := c.Encode(context.Background(), event, dataChan); err != nil {
+		t.Fatal(err)
+	}
+	// a timer that fires after its batch was written must not flush the next batch
+	gen := c.batch.gen
+	c.batch.mu.Lock()
+	c.flush()
+	c.batch.mu.Unlock()
+	if _, err := c.Encode(context.Background(), event, dataChan); err != nil {
+		t.Fatal(err)
+	}
+	c.flushTimer(gen)
+	if len(dataChan) != 0 || len(c.batch.items) != 1 {
+		t.Errorf("stale timer flushed the batch: %d written, %d waiting", len(dataChan), len(c.batch.items))
+	}
+	c.batch.mu.Lock()
+	c.batch.timer.Stop()
+	c.batch.mu.Unlock()
+}
+
+func TestCodec_WindowsEvent(t *testing.T) {
+	c := Codec{Profile: ProfileWindowsEvent, TimestampPath: "Event.System.TimeCreated"}
+	if err := c.initTimestamp(); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		file   string
+		fields map[string]string
+	}{
+		{"windows_4624.xml", map[string]string{
+			"Event.System.EventID":            "4624",
+			"Event.System.ProviderName":       "Microsoft-Windows-Security-Auditing",
+			"Event.System.ProcessID":          "636",
+			"Event.System.Computer":           "DC01.example.com",
+			"Event.EventData.TargetUserName":  "alice",
+			"Event.EventData.LogonType":       "3",
+			"Event.EventData.IpAddress":       "10.0.0.25",
+			"Event.EventData.WorkstationName": "-",
+		}},
+		{"windows_4625.xml", map[string]string{
+			"Event.System.EventID":           "4625",
+			"Event.EventData.TargetUserName": "administrator",
+			"Event.EventData.SubStatus":      "0xc000006a",
+		}},
+		{"windows_7036.xml", map[string]string{
+			"Event.System.EventID":         "7036",
+			"Event.System.Qualifiers":      "16384",
+			"Event.System.EventSourceName": "Service Control Manager",
+			"Event.EventData.param1":       "Windows Update",
+			"Event.EventData.Binary":       "770075006100750073007600630000000000",
+			"Event.RenderingInfo.Level":    "Information",
+		}},
+		{"windows_1102.xml", map[string]string{
+			"Event.System.EventID":                          "1102",
+			"Event.System.UserID":                           "S-1-5-21-3623811015-3361044348-30300820-500",
+			"Event.UserData.LogFileCleared.SubjectUserName": "Administrator",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join("testdata", tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var event logevent.LogEvent
+			if err = c.DecodeEvent(data, &event); err != nil {
+				t.Fatal(err)
+			}
+			for field, want := range tt.fields {
+				if got := event.GetString(field); got != want {
+					t.Errorf("%s: expected %q, got %v", field, want, event.Get(field))
+				}
+			}
+			if len(event.Tags) > 0 || event.Timestamp.Year() != 2023 {
+				t.Errorf("timestamp not taken from event: %v %v", event.Timestamp, event.Tags)
+			}
+		})
+	}
+}
+
+func TestCodec_WindowsEventModes(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "windows_4624.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const uri = "http://schemas.microsoft.com/win/2004/08/events/event"
+	tests := []struct {
+		name   string
+		c      Codec
+		prefix string
+	}{
+		{"map", Codec{Namespaces: NamespaceMap, NamespaceMap: map[string]string{uri: "win"}}, "win:"},
+		{"keep", Codec{Namespaces: NamespaceKeep}, ""},
+		{"attrs_as_fields", Codec{AttrsAsFields: true}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.c.Profile = ProfileWindowsEvent
+			if err := tt.c.checkProfile(); err != nil {
+				t.Fatal(err)
+			}
+			var event logevent.LogEvent
+			if err := tt.c.DecodeEvent(data, &event); err != nil {
+				t.Fatal(err)
+			}
+			system := tt.prefix + "Event." + tt.prefix + "System."
+			fields := map[string]string{
+				system + "TimeCreated":  "2023-03-30T08:15:42.1234567Z",
+				system + "ProviderName": "Microsoft-Windows-Security-Auditing",
+				system + "ProcessID":    "636",
+				system + "EventID":      "4624",
+				tt.prefix + "Event." + tt.prefix + "EventData.TargetUserName": "alice",
+			}
+			for field, want := range fields {
+				if got := event.GetString(field); got != want {
+					t.Errorf("%s: expected %q, got %v", field, want, event.Get(field))
+				}
+			}
+		})
+	}
+}
+func TestCodec_Soap(t *testing.T) {
+	const response = `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">
+<soap:Header><RequestID>abc</RequestID><Trace>1</Trace></soap:Header>
+<soap:Body><GetPriceResponse><Price>34.5</Price></GetPriceResponse></soap:Body>
+</soap:Envelope>`
+	const fault11 = `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><soap:Fault>
+<faultcode>soap:Server</faultcode><faultstring>Server Error</faultstring><detail><code>42</code></detail>
+</soap:Fault></soap:Body></soap:Envelope>`
+	const fault12 = `<env:Envelope xmlns:env="http://www.w3.org/2003/05/soap-envelope"><env:Body><env:Fault>
+<env:Code><env:Value>env:Sender</env:Value><env:Subcode><env:Value>m:MessageTimeout</env:Value></env:Subcode></env:Code>
+<env:Reason><env:Text xml:lang="en">Sender Timeout</env:Text></env:Reason>
+</env:Fault></env:Body></env:Envelope>`
+	tests := []struct {
+		name   string
+		mode   string
+		doc    string
+		fields map[string]string
+		fault  bool
+	}{
+		{"response", NamespaceStrip, response, map[string]string{"GetPriceResponse.Price": "34.5", "soap_header.RequestID": "abc"}, false},
+		{"response keep", NamespaceKeep, response, map[string]string{"GetPriceResponse.Price": "34.5"}, false},
+		{"fault 1.1", NamespaceStrip, fault11, map[string]string{"faultcode": "soap:Server", "faultstring": "Server Error", "detail.code": "42"}, true},
+		{"fault 1.2", NamespaceKeep, fault12, map[string]string{"faultcode": "env:Sender", "faultsubcode": "m:MessageTimeout", "faultstring": "Sender Timeout"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := Codec{Profile: ProfileSoap, Namespaces: tt.mode, SoapHeaders: []string{"RequestID"}}
+			var event logevent.LogEvent
+			if err := c.DecodeEvent([]byte(tt.doc), &event); err != nil {
+				t.Fatal(err)
+			}
+			for field, want := range tt.fields {
+				if got := event.GetString(field); got != want {
+					t.Errorf("%s: expected %q, got %v", field, want, event.Get(field))
+				}
+			}
+			if event.Get("soap_header.Trace") != nil || event.Get("Envelope") != nil {
+				t.Errorf("unexpected fields in %v", event.Extra)
+			}
+			// a fault is tagged both as an error and as a fault
+			if fault := len(event.Tags) == 2 && event.Tags[0] == ErrorTag && event.Tags[1] == FaultTag; fault != tt.fault || (!fault && len(event.Tags) > 0) {
+				t.Errorf("expected fault %v, got tags %v", tt.fault, event.Tags)
+			}
+		})
+	}
+}
+
+func TestCodec_Xsd(t *testing.T) {
+	const valid = `<order version="1"><id>1</id><status>open</status><line><sku>ABC-1</sku><qty>2</qty></line><line><sku>DEF-2</sku><qty>1</qty></line></order>`
+	const invalid = `<order><status>lost</status><id>x</id><line><sku>abc</sku><qty>0</qty><extra/></line></order>`
+	tests := []struct {
+		name       string
+		doc        string
+		maxErrors  int
+		violations int
+	}{
+		{"valid", valid, 10, 0},
+		{"invalid", invalid, 10, 7},
+		{"max errors", invalid, 2, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := Codec{Xsd: filepath.Join("testdata", "order.xsd"), XsdMaxErrors: tt.maxErrors, XsdErrorField: XsdErrorField}
+			if err := c.loadSchema(); err != nil {
+				t.Fatal(err)
+			}
+			var event logevent.LogEvent
+			if err := c.DecodeEvent([]byte(tt.doc), &event); err != nil {
+				t.Fatal(err)
+			}
+			violations, _ := event.Get(XsdErrorField).([]string)
+			if len(violations) != tt.violations {
+				t.Errorf("expected %d violations, got %q", tt.violations, violations)
+			}
+			if tagged := len(event.Tags) == 1 && event.Tags[0] == XsdErrorTag; tagged != (tt.violations > 0) {
+				t.Errorf("unexpected tags %v", event.Tags)
+			}
+		})
+	}
+
+	c := Codec{Xsd: filepath.Join("testdata", "order.xsd"), XsdMaxErrors: 10, XsdReject: true, SplitPath: "orders.order", OnError: OnErrorTag, ErrorField: ErrorField}
+	if err := c.loadSchema(); err != nil {
+		t.Fatal(err)
+	}
+	msgChan := make(chan logevent.LogEvent, 2)
+	if _, err := c.Decode(context.Background(), "<orders>"+valid+invalid+"</orders>", nil, nil, msgChan); err != nil {
+		t.Fatal(err)
+	}
+	if event := <-msgChan; event.GetString("order.id") != "1" {
+		t.Errorf("expected valid order, got %v", event.Extra)
+	}
+	if event := <-msgChan; !strings.HasPrefix(event.GetString(ErrorField), "xsd validation failed: order: ") {
+		t.Errorf("expected rejected order, got %v", event.Extra)
+	}
+}
+
+func TestCodec_XsdRecursive(t *testing.T) {
+	schemas := map[string]string{
+		"element ref": `<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema">
+  <xs:element name="node">
+    <xs:complexType>
+      <xs:sequence>
+        <xs:element name="value" type="xs:int"/>
+        <xs:element ref="node" minOccurs="0" maxOccurs="unbounded"/>
+      </xs:sequence>
+    </xs:complexType>
+  </xs:element>
+</xs:schema>`,
+		"named type": `<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema">
+  <xs:element name="node" type="nodeType"/>
+  <xs:complexType name="nodeType">
+    <xs:sequence>
+      <xs:element name="value" type="xs:int"/>
+      <xs:element name="node" type="nodeType" minOccurs="0" maxOccurs="unbounded"/>
+    </xs:sequence>
+  </xs:complexType>
+</xs:schema>`,
+	}
+	const doc = `<node><value>1</value><node><value>2</value><node><value>x</value></node></node></node>`
+	for name, schema := range schemas {
+		t.Run(name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "schema.xsd")
+			if err := os.WriteFile(filename, []byte(schema), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			c := Codec{Xsd: filename, XsdMaxErrors: 10, XsdErrorField: XsdErrorField}
+			if err := c.loadSchema(); err != nil {
+				t.Fatal(err)
+			}
+			var event logevent.LogEvent
+			if err := c.DecodeEvent([]byte(doc), &event); err != nil {
+				t.Fatal(err)
+			}
+			violations, _ := event.Get(XsdErrorField).([]string)
+			if len(violations) != 1 || !strings.HasPrefix(violations[0], "node.node.node.value: ") {
+				t.Errorf("expected violation at the innermost value, got %q", violations)
+			}
+		})
+	}
+}
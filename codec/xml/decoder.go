@@ -0,0 +1,204 @@
+package xml
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// mxjAttrPrefix and mxjTextKey are the keys mxj uses for attributes and text in elements that also has children
+const (
+	mxjAttrPrefix = "-"
+	mxjTextKey    = "#text"
+)
+
+// trimRunes are removed from both ends of text values
+const trimRunes = "\t\r\b\n "
+
+// decoder holds the state while decoding a document
+type decoder struct {
+	*xml.Decoder
+	codec    *Codec
+	scope    []map[string]string // namespace URI -> prefix declared on each open element, innermost last
+	report   report              // tags and fields to add to the event
+	elements int                 // number of elements read, checked against MaxElements
+
+	validator *validator // validates the document against the schema, nil if not validated
+}
+
+// report holds tags and fields for the event found while decoding
+type report struct {
+	tags   []string
+	fields map[string]interface{}
+}
+
+// newReader returns a reader for 'data', limited to MaxBytes
+func (c *Codec) newReader(data interface{}) (io.Reader, error) {
+	data, err := c.limitSize(data)
+	if err != nil {
+		return nil, err
+	}
+	switch v := data.(type) {
+	case string:
+		return strings.NewReader(v), nil
+	case []byte:
+		return bytes.NewReader(v), nil
+	case io.Reader:
+		return v, nil
+	}
+	return nil, errUnsupportedInput
+}
+
+// newDecoder returns a decoder that reads from 'r'
+func (c *Codec) newDecoder(r io.Reader) *decoder {
+	r, converted := c.toUTF8(r)
+	d := &decoder{
+		Decoder: xml.NewDecoder(r),
+		codec:   c,
+	}
+	d.CharsetReader = charsetReader
+	if converted {
+		d.CharsetReader = func(_ string, input io.Reader) (io.Reader, error) {
+			return input, nil
+		}
+	}
+	return d
+}
+
+// Token returns the next token, keeps track of namespace declarations and enforces limits
+func (d *decoder) Token() (xml.Token, error) {
+	t, err := d.Decoder.Token()
+	if err != nil {
+		return t, err
+	}
+	switch tt := t.(type) {
+	case xml.StartElement:
+		d.push(tt)
+	case xml.EndElement:
+		d.scope = d.scope[:len(d.scope)-1]
+	}
+	return t, d.checkToken(t)
+}
+
+// root reads until the first element in the document and returns it
+func (d *decoder) root() (start xml.StartElement, err error) {
+	for {
+		var t xml.Token
+		t, err = d.Token()
+		if err != nil {
+			return
+		}
+		if se, ok := t.(xml.StartElement); ok {
+			return se, nil
+		}
+	}
+}
+
+// addTag adds 'tag' to the tags for the event
+func (r *report) addTag(tag string) {
+	for _, t := range r.tags {
+		if t == tag {
+			return
+		}
+	}
+	r.tags = append(r.tags, tag)
+}
+
+// setField sets 'field' in the event to 'value'
+func (r *report) setField(field string, value interface{}) {
+	if r.fields == nil {
+		r.fields = make(map[string]interface{})
+	}
+	r.fields[field] = value
+}
+
+// element reads the element started by 'start' until the matching end element and returns its value.
+// 'path' is the dot separated path to the element, used to look up types.
+// The layout follows mxj: attributes are prefixed (see attrKey), repeated elements become a list and elements
+// without attributes and children are returned as a simple value.
+func (d *decoder) element(start xml.StartElement, path string) (interface{}, error) {
+	c := d.codec
+	if d.validator != nil {
+		d.validator.start(start, path)
+	}
+	node := make(map[string]interface{})
+	for _, attr := range start.Attr {
+		if key, ok := d.attrName(attr.Name); ok {
+			key = c.attrKey(key)
+			node[key] = d.convert(path+"."+key, attr.Value)
+		}
+	}
+	var text strings.Builder
+	for {
+		t, err := d.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch tt := t.(type) {
+		case xml.StartElement:
+			name := d.name(tt.Name)
+			childPath := path + "." + name
+			value, err := d.element(tt, childPath)
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := node[name]; !ok && c.forceArray(childPath) {
+				value = []interface{}{value}
+			}
+			addValue(node, name, value)
+		case xml.CharData:
+			text.Write(tt)
+		case xml.EndElement:
+			s := strings.Trim(text.String(), trimRunes)
+			if d.validator != nil {
+				d.validator.end(s)
+			}
+			if len(node) == 0 {
+				return d.convert(path, s), nil
+			}
+			if len(s) > 0 {
+				node[c.textKey()] = d.convert(path+"."+c.textKey(), s)
+			}
+			return node, nil
+		}
+	}
+}
+
+// addValue adds 'value' to 'node', turning it into a list if 'key' is already present
+func addValue(node map[string]interface{}, key string, value interface{}) {
+	existing, ok := node[key]
+	if !ok {
+		node[key] = value
+		return
+	}
+	if list, ok := existing.([]interface{}); ok {
+		node[key] = append(list, value)
+	} else {
+		node[key] = []interface{}{existing, value}
+	}
+}
+
+// cast converts 's' to float64 or bool if TryCast is set, using the same rules as mxj
+func (c *Codec) cast(s string) interface{} {
+	if !c.TryCast {
+		return s
+	}
+	switch strings.ToLower(s) {
+	case "nan", "inf", "-inf":
+		return s
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return f
+	}
+	if len(s) > 0 && len(s) < 6 {
+		switch s[:1] {
+		case "t", "T", "f", "F":
+			if b, err := strconv.ParseBool(s); err == nil {
+				return b
+			}
+		}
+	}
+	return s
+}
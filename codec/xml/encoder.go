@@ -0,0 +1,149 @@
+package xml
+
+import (
+	"encoding/xml"
+	"fmt"
+	mjx "github.com/clbanning/mxj/v2"
+	"github.com/tsaikd/gogstash/config/logevent"
+	"strings"
+)
+
+// Ways to write tags when encoding
+const (
+	TagsRepeat = "repeat" // one <tags> element for each tag, default
+	TagsJoin   = "join"   // a single <tags> element with a comma separated list
+	TagsNested = "nested" // a <tags> element with one <tag> element for each tag
+)
+
+const timestampKey = "timestamp" // default element for @timestamp
+
+// checkEncoder validates the encoder configuration
+func (c *Codec) checkEncoder() error {
+	switch c.TagsMode {
+	case "":
+		c.TagsMode = TagsRepeat
+	case TagsRepeat, TagsJoin, TagsNested:
+	default:
+		return fmt.Errorf("invalid tags_mode %q", c.TagsMode)
+	}
+	return nil
+}
+
+// encode returns 'event' as a XML document
+func (c *Codec) encode(event logevent.LogEvent) ([]byte, error) {
+	output, err := c.marshal(event, "", c.RootTag)
+	if err != nil {
+		return nil, err
+	}
+	if c.Declaration {
+		output = append([]byte(xml.Header), output...)
+	}
+	return output, nil
+}
+
+// marshal returns 'event' as an element named 'rootTag', each line starts with 'prefix' when indenting
+func (c *Codec) marshal(event logevent.LogEvent, prefix string, rootTag string) ([]byte, error) {
+	m, err := c.encodeMap(event)
+	if err != nil {
+		return nil, err
+	}
+	var tag []string
+	if len(rootTag) > 0 {
+		tag = append(tag, rootTag)
+	}
+	if len(c.Indent) > 0 {
+		return m.XmlIndent(prefix, c.Indent, tag...)
+	}
+	return m.Xml(tag...)
+}
+
+// encodeMap returns the map to give to mxj for 'event'
+func (c *Codec) encodeMap(event logevent.LogEvent) (mjx.Map, error) {
+	json, err := event.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	m, err := mjx.NewMapJson(json)
+	if err != nil {
+		return nil, err
+	}
+	c.selectFields(m)
+	if _, ok := m["@timestamp"]; ok {
+		delete(m, "@timestamp")
+		key := c.TimestampKey
+		if len(key) == 0 {
+			key = timestampKey
+		}
+		m[key] = c.formatTimestamp(event)
+	}
+	if len(event.Tags) > 0 {
+		if _, ok := m["tags"]; ok {
+			m["tags"] = c.formatTags(event.Tags)
+		}
+	}
+	if c.UnwrapArrays {
+		c.unwrapArrays(m)
+	}
+	if m, err = c.encodeAttributes(m); err != nil {
+		return nil, err
+	}
+	if m, err = c.encodeNamespaces(m); err != nil {
+		return nil, err
+	}
+	for _, field := range c.RootAttributes {
+		switch v := m[field].(type) {
+		case string, float64, bool:
+			delete(m, field)
+			m[mxjAttrPrefix+field] = v
+		}
+	}
+	return m, nil
+}
+
+// selectFields removes fields from 'm' that are not in Include, or are in Exclude
+func (c *Codec) selectFields(m mjx.Map) {
+	if len(c.Include) > 0 {
+		keep := make(map[string]bool, len(c.Include))
+		for _, field := range c.Include {
+			keep[field] = true
+		}
+		for field := range m {
+			if !keep[field] {
+				delete(m, field)
+			}
+		}
+	}
+	for _, field := range c.Exclude {
+		delete(m, field)
+	}
+}
+
+// formatTimestamp returns the event time as it should be written, in Timezone or UTC
+func (c *Codec) formatTimestamp(event logevent.LogEvent) string {
+	if len(c.TimestampFormat) == 0 {
+		return event.Timestamp.UTC().Format("2006-01-02T15:04:05.999999999Z07:00")
+	}
+	layout := c.TimestampFormat
+	if named, ok := namedLayouts[layout]; ok {
+		layout = named
+	}
+	if c.location != nil {
+		return event.Timestamp.In(c.location).Format(layout)
+	}
+	return event.Timestamp.UTC().Format(layout)
+}
+
+// formatTags returns the tags as they should be written according to TagsMode
+func (c *Codec) formatTags(tags []string) interface{} {
+	switch c.TagsMode {
+	case TagsJoin:
+		return strings.Join(tags, ",")
+	case TagsNested:
+		list := make([]interface{}, len(tags))
+		for i := range tags {
+			list[i] = tags[i]
+		}
+		return map[string]interface{}{"tag": list}
+	}
+	return tags
+}
@@ -0,0 +1,27 @@
+package xml
+
+import (
+	mjx "github.com/clbanning/mxj/v2"
+)
+
+// extract returns a map with only the configured Fields taken from 'm', and the full document in DocumentField if set.
+// Paths use the mxj syntax, e.g. "Event.System.Security.-UserID". Fields that are not found are left out, a path
+// matching more than one value gives a list.
+func (c *Codec) extract(m mjx.Map) mjx.Map {
+	result := make(mjx.Map, len(c.Fields)+1)
+	for field, path := range c.Fields {
+		values, err := m.ValuesForPath(path)
+		if err != nil || len(values) == 0 {
+			continue
+		}
+		if len(values) == 1 {
+			result[field] = values[0]
+		} else {
+			result[field] = values
+		}
+	}
+	if len(c.DocumentField) > 0 {
+		result[c.DocumentField] = map[string]interface{}(m)
+	}
+	return result
+}
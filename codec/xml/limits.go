@@ -0,0 +1,77 @@
+package xml
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+)
+
+var (
+	errMaxBytes    = errors.New("document exceeds max_bytes")
+	errMaxDepth    = errors.New("document exceeds max_depth")
+	errMaxElements = errors.New("document exceeds max_elements")
+	errDoctype     = errors.New("DOCTYPE is not allowed")
+)
+
+// limitReader returns errMaxBytes when more than 'left' bytes are read
+type limitReader struct {
+	r    io.Reader
+	left int64
+}
+
+// Read implements io.Reader
+func (l *limitReader) Read(p []byte) (n int, err error) {
+	if l.left < 0 {
+		return 0, errMaxBytes
+	}
+	if int64(len(p)) > l.left+1 {
+		p = p[:l.left+1]
+	}
+	n, err = l.r.Read(p)
+	l.left -= int64(n)
+	if l.left < 0 {
+		return n, errMaxBytes
+	}
+	return
+}
+
+// limitSize checks 'data' against MaxBytes, readers are wrapped so the limit is checked while reading
+func (c *Codec) limitSize(data interface{}) (interface{}, error) {
+	if c.MaxBytes <= 0 {
+		return data, nil
+	}
+	switch v := data.(type) {
+	case string:
+		if int64(len(v)) > c.MaxBytes {
+			return nil, errMaxBytes
+		}
+	case []byte:
+		if int64(len(v)) > c.MaxBytes {
+			return nil, errMaxBytes
+		}
+	case io.Reader:
+		return &limitReader{r: v, left: c.MaxBytes}, nil
+	}
+	return data, nil
+}
+
+// checkToken enforces the limits on each token read
+func (d *decoder) checkToken(t xml.Token) error {
+	c := d.codec
+	switch tt := t.(type) {
+	case xml.StartElement:
+		if c.MaxDepth > 0 && len(d.scope) > c.MaxDepth {
+			return errMaxDepth
+		}
+		d.elements++
+		if c.MaxElements > 0 && d.elements > c.MaxElements {
+			return errMaxElements
+		}
+	case xml.Directive:
+		if !c.AllowDoctype && bytes.HasPrefix(bytes.TrimSpace(tt), []byte("DOCTYPE")) {
+			return errDoctype
+		}
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+package xml
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+)
+
+// Namespace modes. When no mode is set documents are decoded as mxj did: local names are used and xmlns declarations
+// are kept as attributes named by their prefix. Keys are not changed on encode.
+const (
+	NamespaceStrip = "strip" // use local names only, xmlns declarations are removed
+	NamespaceKeep  = "keep"  // keep prefixes as written in the document, including xmlns declarations
+	NamespaceMap   = "map"   // use prefixes from NamespaceMap, unknown namespaces are stripped
+)
+
+// xmlURL is the namespace bound to the reserved xml prefix
+const xmlURL = "http://www.w3.org/XML/1998/namespace"
+
+// checkNamespaces validates the namespace configuration
+func (c *Codec) checkNamespaces() error {
+	switch c.Namespaces {
+	case "", NamespaceStrip, NamespaceKeep:
+	case NamespaceMap:
+		for uri, prefix := range c.NamespaceMap {
+			if len(prefix) == 0 || strings.Contains(prefix, ":") {
+				return fmt.Errorf("invalid prefix %q for namespace %s", prefix, uri)
+			}
+		}
+	default:
+		return fmt.Errorf("invalid namespaces mode %q", c.Namespaces)
+	}
+	return nil
+}
+
+// push records the namespace declarations in 'start'
+func (d *decoder) push(start xml.StartElement) {
+	var declared map[string]string
+	for _, attr := range start.Attr {
+		var prefix string
+		switch {
+		case attr.Name.Space == "xmlns":
+			prefix = attr.Name.Local
+		case attr.Name.Space == "" && attr.Name.Local == "xmlns":
+		default:
+			continue
+		}
+		if declared == nil {
+			declared = make(map[string]string)
+		}
+		declared[attr.Value] = prefix
+	}
+	d.scope = append(d.scope, declared)
+}
+
+// prefix returns the prefix used in the document for namespace 'uri'
+func (d *decoder) prefix(uri string) string {
+	if uri == xmlURL {
+		return "xml"
+	}
+	for i := len(d.scope) - 1; i >= 0; i-- {
+		if prefix, ok := d.scope[i][uri]; ok {
+			return prefix
+		}
+	}
+	return ""
+}
+
+// qualify returns 'local' with the prefix for 'uri' according to the namespace mode
+func (d *decoder) qualify(uri, local string) string {
+	if len(uri) == 0 {
+		return local
+	}
+	var prefix string
+	switch d.codec.Namespaces {
+	case NamespaceKeep:
+		prefix = d.prefix(uri)
+	case NamespaceMap:
+		prefix = d.codec.NamespaceMap[uri]
+	}
+	if len(prefix) == 0 {
+		return local
+	}
+	return prefix + ":" + local
+}
+
+// name returns the key for an element
+func (d *decoder) name(n xml.Name) string {
+	return d.qualify(n.Space, n.Local)
+}
+
+// attrName returns the key for an attribute, false if the attribute should be left out
+func (d *decoder) attrName(n xml.Name) (string, bool) {
+	if n.Space == "xmlns" || (n.Space == "" && n.Local == "xmlns") {
+		switch d.codec.Namespaces {
+		case "":
+			// as mxj, xmlns:ns becomes ns and xmlns stays xmlns
+			return n.Local, true
+		case NamespaceKeep:
+			if n.Space == "xmlns" {
+				return "xmlns:" + n.Local, true
+			}
+			return n.Local, true
+		}
+		return "", false
+	}
+	return d.qualify(n.Space, n.Local), true
+}
+
+// encodeNamespaces prepares 'm' for encoding according to the namespace mode. Keys are only changed when a mode is set.
+func (c *Codec) encodeNamespaces(m map[string]interface{}) (map[string]interface{}, error) {
+	switch c.Namespaces {
+	case NamespaceStrip:
+		result, err := renameKeys(m, func(key string) (string, bool) {
+			if strings.HasPrefix(key, mxjAttrPrefix+"xmlns") {
+				return "", false
+			}
+			return stripPrefix(key), true
+		})
+		if err != nil {
+			return nil, err
+		}
+		return result.(map[string]interface{}), nil
+	case NamespaceMap:
+		for uri, prefix := range c.NamespaceMap {
+			m[mxjAttrPrefix+"xmlns:"+prefix] = uri
+		}
+	}
+	return m, nil
+}
+
+// stripPrefix removes the namespace prefix from an element or attribute key
+func stripPrefix(key string) string {
+	idx := strings.Index(key, ":")
+	if idx < 0 {
+		return key
+	}
+	if strings.HasPrefix(key, mxjAttrPrefix) {
+		return mxjAttrPrefix + key[idx+1:]
+	}
+	return key[idx+1:]
+}
+
+// renameKeys returns a copy of 'value' where all map keys are passed through 'fn'. Keys where 'fn' returns false are removed.
+// An error is returned if two keys in the same map get the same name.
+func renameKeys(value interface{}, fn func(key string) (string, bool)) (interface{}, error) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		from := make(map[string]string, len(v))
+		for key, child := range v {
+			newKey, ok := fn(key)
+			if !ok {
+				continue
+			}
+			if other, found := from[newKey]; found {
+				return nil, fmt.Errorf("fields %s and %s are both encoded as %s", other, key, newKey)
+			}
+			from[newKey] = key
+			renamed, err := renameKeys(child, fn)
+			if err != nil {
+				return nil, err
+			}
+			result[newKey] = renamed
+		}
+		return result, nil
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i := range v {
+			renamed, err := renameKeys(v[i], fn)
+			if err != nil {
+				return nil, err
+			}
+			result[i] = renamed
+		}
+		return result, nil
+	}
+	return value, nil
+}
@@ -0,0 +1,38 @@
+package xml
+
+import (
+	"fmt"
+	mjx "github.com/clbanning/mxj/v2"
+)
+
+// Profiles for well known documents
+const (
+	ProfileWindowsEvent = "windows_event" // rendered Windows event log XML
+	ProfileSoap         = "soap"          // SOAP 1.1 and 1.2 messages
+)
+
+// checkProfile validates the profile configuration. Profiles strip namespaces unless another mode is set,
+// so xmlns declarations are not kept as attributes.
+func (c *Codec) checkProfile() error {
+	switch c.Profile {
+	case "":
+		return nil
+	case ProfileWindowsEvent, ProfileSoap:
+		if len(c.Namespaces) == 0 {
+			c.Namespaces = NamespaceStrip
+		}
+		return nil
+	}
+	return fmt.Errorf("invalid profile %q", c.Profile)
+}
+
+// applyProfile normalizes 'm' according to Profile, and returns tags to add to the event
+func (c *Codec) applyProfile(m mjx.Map) (mjx.Map, []string) {
+	switch c.Profile {
+	case ProfileWindowsEvent:
+		c.windowsEvent(m)
+	case ProfileSoap:
+		return c.soap(m)
+	}
+	return m, nil
+}
@@ -0,0 +1,126 @@
+package xml
+
+import (
+	"fmt"
+	mjx "github.com/clbanning/mxj/v2"
+)
+
+// FaultTag tag added to event when a SOAP message contains a Fault
+const FaultTag = "gogstash_codec_xml_soap_fault"
+
+const SoapHeaderField = "soap_header" // default field for SOAP header elements
+
+// soap replaces the envelope in 'm' with the content of the body, and the selected headers in SoapHeaderField.
+// A Fault is returned as faultcode, faultstring, faultactor and detail with FaultTag and ErrorTag. Elements are matched on
+// their local name so both SOAP 1.1 and 1.2 work with all namespace modes.
+func (c *Codec) soap(m mjx.Map) (mjx.Map, []string) {
+	envelope, ok := child(m, "Envelope").(map[string]interface{})
+	if !ok {
+		return m, nil
+	}
+	result := make(mjx.Map)
+	if header, ok := child(envelope, "Header").(map[string]interface{}); ok {
+		if headers := c.soapHeaders(header); len(headers) > 0 {
+			field := c.SoapHeaderField
+			if len(field) == 0 {
+				field = SoapHeaderField
+			}
+			result[field] = headers
+		}
+	}
+	body, ok := child(envelope, "Body").(map[string]interface{})
+	if !ok {
+		return result, nil
+	}
+	if fault, ok := child(body, "Fault").(map[string]interface{}); ok {
+		c.soapFault(fault, result)
+		return result, []string{ErrorTag, FaultTag}
+	}
+	for key, value := range body {
+		if !c.isAttr(key) {
+			result[key] = value
+		}
+	}
+	return result, nil
+}
+
+// soapHeaders returns the header elements listed in SoapHeaders, or all of them if the list is empty
+func (c *Codec) soapHeaders(header map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{})
+	for key, value := range header {
+		if c.isAttr(key) {
+			continue
+		}
+		name := stripPrefix(key)
+		if len(c.SoapHeaders) == 0 {
+			result[name] = value
+			continue
+		}
+		for _, h := range c.SoapHeaders {
+			if h == name {
+				result[name] = value
+			}
+		}
+	}
+	return result
+}
+
+// soapFault adds the fields from a SOAP 1.1 or 1.2 fault to 'result'
+func (c *Codec) soapFault(fault map[string]interface{}, result mjx.Map) {
+	set := func(field string, value interface{}) {
+		if value != nil {
+			result[field] = value
+		}
+	}
+	// SOAP 1.1
+	set("faultcode", c.text(child(fault, "faultcode")))
+	set("faultstring", c.text(child(fault, "faultstring")))
+	set("faultactor", c.text(child(fault, "faultactor")))
+	set("detail", child(fault, "detail"))
+	// SOAP 1.2
+	if code, ok := child(fault, "Code").(map[string]interface{}); ok {
+		set("faultcode", c.text(child(code, "Value")))
+		if subcode, ok := child(code, "Subcode").(map[string]interface{}); ok {
+			set("faultsubcode", c.text(child(subcode, "Value")))
+		}
+	}
+	if reason, ok := child(fault, "Reason").(map[string]interface{}); ok {
+		set("faultstring", c.text(child(reason, "Text")))
+	}
+	set("faultactor", c.text(child(fault, "Role")))
+	set("detail", child(fault, "Detail"))
+}
+
+// child returns the value in 'm' of the element with local name 'local'
+func child(m map[string]interface{}, local string) interface{} {
+	for key, value := range m {
+		if stripPrefix(key) == local {
+			return value
+		}
+	}
+	return nil
+}
+
+// isAttr returns true if 'key' is an attribute
+func (c *Codec) isAttr(key string) bool {
+	prefix := c.attrKey("")
+	return len(prefix) > 0 && len(key) > len(prefix) && key[:len(prefix)] == prefix
+}
+
+// text returns the text of an element, the first one if it is a list
+func (c *Codec) text(value interface{}) interface{} {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case string:
+		return v
+	case []interface{}:
+		if len(v) > 0 {
+			return c.text(v[0])
+		}
+		return nil
+	case map[string]interface{}:
+		return c.text(v[c.textKey()])
+	}
+	return fmt.Sprint(value)
+}
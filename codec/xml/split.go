@@ -0,0 +1,69 @@
+package xml
+
+import (
+	"encoding/xml"
+	mjx "github.com/clbanning/mxj/v2"
+	"io"
+	"strings"
+)
+
+// split reads the document from 'r' and calls 'handler' for each element found at SplitPath.
+// Only the element being handled is kept in memory. The handler gets an error if the element failed validation with XsdReject.
+func (c *Codec) split(r io.Reader, handler func(m mjx.Map, rep report, err error)) error {
+	path := strings.Split(c.SplitPath, ".")
+	d := c.newDecoder(r)
+	var stack []string // names of open elements
+	for {
+		t, err := d.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch tt := t.(type) {
+		case xml.StartElement:
+			name := d.name(tt.Name)
+			stack = append(stack, name)
+			if !samePath(stack, path) {
+				continue
+			}
+			d.report = report{}
+			d.elements = 1
+			d.validate(tt.Name.Local, true)
+			value, err := d.element(tt, name)
+			if err != nil {
+				return err
+			}
+			stack = stack[:len(stack)-1]
+			handler(mjx.Map{name: value}, d.report, d.finishValidation())
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		}
+	}
+}
+
+// samePath returns true if both paths are equal
+func samePath(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// copyExtra returns a shallow copy of 'extra' so each event gets its own map
+func copyExtra(extra map[string]interface{}) map[string]interface{} {
+	if extra == nil {
+		return nil
+	}
+	result := make(map[string]interface{}, len(extra))
+	for k, v := range extra {
+		result[k] = v
+	}
+	return result
+}
@@ -0,0 +1,83 @@
+package xml
+
+import (
+	"errors"
+	"fmt"
+	mjx "github.com/clbanning/mxj/v2"
+	"math"
+	"strconv"
+	"time"
+)
+
+// TimestampErrorTag tag added to event when the timestamp could not be taken from the document
+const TimestampErrorTag = "gogstash_codec_xml_timestamp_error"
+
+// Special timestamp layouts
+const (
+	LayoutUnix   = "UNIX"    // seconds since epoch
+	LayoutUnixMS = "UNIX_MS" // milliseconds since epoch
+)
+
+var errNoTimestamp = errors.New("no timestamp in document")
+
+// initTimestamp validates the timestamp configuration
+func (c *Codec) initTimestamp() (err error) {
+	if len(c.TimestampLayouts) == 0 {
+		c.TimestampLayouts = []string{"RFC3339"}
+	}
+	if len(c.Timezone) > 0 {
+		c.location, err = time.LoadLocation(c.Timezone)
+	}
+	return
+}
+
+// timestamp returns the time found at TimestampPath in 'm', trying each of the layouts in turn
+func (c *Codec) timestamp(m mjx.Map) (time.Time, error) {
+	values, err := m.ValuesForPath(c.TimestampPath)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if len(values) == 0 {
+		return time.Time{}, errNoTimestamp
+	}
+	switch v := values[0].(type) {
+	case time.Time:
+		return v, nil
+	case float64:
+		return c.parseTime(strconv.FormatFloat(v, 'f', -1, 64))
+	case int64:
+		return c.parseTime(strconv.FormatInt(v, 10))
+	case string:
+		return c.parseTime(v)
+	}
+	return time.Time{}, fmt.Errorf("invalid timestamp %v", values[0])
+}
+
+// parseTime parses 's' with the first matching layout
+func (c *Codec) parseTime(s string) (time.Time, error) {
+	location := c.location
+	if location == nil {
+		location = time.UTC
+	}
+	for _, layout := range c.TimestampLayouts {
+		switch layout {
+		case LayoutUnix, LayoutUnixMS:
+			f, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				continue
+			}
+			if layout == LayoutUnixMS {
+				f /= 1000
+			}
+			sec, frac := math.Modf(f)
+			return time.Unix(int64(sec), int64(frac*1e9)), nil
+		}
+		if named, ok := namedLayouts[layout]; ok {
+			layout = named
+		}
+		if t, err := time.ParseInLocation(layout, s, location); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("timestamp %q does not match any layout", s)
+}
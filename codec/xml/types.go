@@ -0,0 +1,73 @@
+package xml
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CastErrorTag tag added to event when a value could not be converted to the type given in Types
+const CastErrorTag = "gogstash_codec_xml_cast_error"
+
+// timePrefix starts a time type, followed by the layout
+const timePrefix = "time:"
+
+// namedLayouts are layouts that can be given by name in a time type
+var namedLayouts = map[string]string{
+	"ANSIC":       time.ANSIC,
+	"RFC822":      time.RFC822,
+	"RFC822Z":     time.RFC822Z,
+	"RFC850":      time.RFC850,
+	"RFC1123":     time.RFC1123,
+	"RFC1123Z":    time.RFC1123Z,
+	"RFC3339":     time.RFC3339,
+	"RFC3339Nano": time.RFC3339Nano,
+}
+
+// checkTypes validates the types configuration
+func (c *Codec) checkTypes() error {
+	for path, t := range c.Types {
+		switch {
+		case t == "int", t == "float", t == "bool", t == "string":
+		case strings.HasPrefix(t, timePrefix) && len(t) > len(timePrefix):
+		default:
+			return fmt.Errorf("invalid type %q for %s", t, path)
+		}
+	}
+	return nil
+}
+
+// convert returns 's' as the type configured for 'path', falling back to cast if no type is configured.
+// If the conversion fails the string is returned and a tag is added to the event.
+func (d *decoder) convert(path string, s string) interface{} {
+	t, ok := d.codec.Types[path]
+	if !ok {
+		return d.codec.cast(s)
+	}
+	value, err := convertType(t, s)
+	if err != nil {
+		d.report.addTag(CastErrorTag)
+		return s
+	}
+	return value
+}
+
+// convertType converts 's' to type 't'
+func convertType(t string, s string) (interface{}, error) {
+	switch t {
+	case "int":
+		return strconv.ParseInt(s, 10, 64)
+	case "float":
+		return strconv.ParseFloat(s, 64)
+	case "bool":
+		return strconv.ParseBool(s)
+	case "string":
+		return s, nil
+	}
+	layout := strings.TrimPrefix(t, timePrefix)
+	if named, ok := namedLayouts[layout]; ok {
+		layout = named
+	}
+	return time.Parse(layout, s)
+}
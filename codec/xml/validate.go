@@ -0,0 +1,206 @@
+package xml
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+)
+
+// xsiURL is the namespace for schema instance attributes like xsi:schemaLocation, they are not validated
+const xsiURL = "http://www.w3.org/2001/XMLSchema-instance"
+
+// frame is the validation state of an open element
+type frame struct {
+	path   string
+	typ    *xsdType       // nil if the content is not validated
+	counts map[string]int // number of each child element
+	pos    int            // index of the last child seen in an ordered sequence
+}
+
+// validator checks a document against the schema while it is decoded
+type validator struct {
+	schema     *xsdSchema
+	stack      []*frame
+	violations []string
+	max        int
+}
+
+// violation records a schema violation at 'path', only the first 'max' are kept
+func (v *validator) violation(path, format string, args ...interface{}) {
+	if len(v.violations) < v.max {
+		v.violations = append(v.violations, path+": "+fmt.Sprintf(format, args...))
+	}
+}
+
+// start checks the element started by 'start' against its parent and pushes it on the stack
+func (v *validator) start(start xml.StartElement, path string) {
+	name := start.Name.Local
+	f := &frame{path: path}
+	defer func() { v.stack = append(v.stack, f) }()
+	var decl *xsdElement
+	if len(v.stack) == 0 {
+		if decl = v.schema.elements[name]; decl == nil {
+			v.violation(path, "element %s is not declared", name)
+			return
+		}
+	} else {
+		parent := v.stack[len(v.stack)-1]
+		if parent.typ == nil {
+			return
+		}
+		idx := -1
+		for i, child := range parent.typ.children {
+			if child.name == name {
+				idx = i
+				break
+			}
+		}
+		if idx < 0 {
+			v.violation(path, "element %s is not allowed here", name)
+			return
+		}
+		decl = parent.typ.children[idx]
+		parent.counts[name]++
+		switch {
+		case parent.typ.ordered && idx < parent.pos:
+			v.violation(path, "element %s is out of order", name)
+		case parent.typ.model == "choice" && len(parent.counts) > 1 && !allowsRepeat(parent.typ):
+			v.violation(path, "element %s is not allowed together with %s", name, chosen(parent.counts, name))
+		case decl.maxOccurs >= 0 && parent.counts[name] > decl.maxOccurs:
+			v.violation(path, "element %s occurs more than %d times", name, decl.maxOccurs)
+		}
+		if idx > parent.pos {
+			parent.pos = idx
+		}
+	}
+	f.typ = decl.typ
+	f.counts = make(map[string]int)
+	v.attributes(start, f)
+}
+
+// allowsRepeat returns true if the children of 't' may repeat, as in a choice with maxOccurs above 1
+func allowsRepeat(t *xsdType) bool {
+	for _, child := range t.children {
+		if child.maxOccurs != 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// chosen returns the first child in 'counts' other than 'name'
+func chosen(counts map[string]int, name string) string {
+	for k := range counts {
+		if k != name {
+			return k
+		}
+	}
+	return name
+}
+
+// attributes checks the attributes on 'start'
+func (v *validator) attributes(start xml.StartElement, f *frame) {
+	if f.typ == nil {
+		return
+	}
+	found := make(map[string]bool)
+	for _, attr := range start.Attr {
+		switch {
+		case attr.Name.Space == "xmlns", attr.Name.Local == "xmlns" && attr.Name.Space == "":
+			continue
+		case attr.Name.Space == xsiURL, attr.Name.Space == xmlURL:
+			continue
+		}
+		found[attr.Name.Local] = true
+		var decl *xsdAttribute
+		for _, a := range f.typ.attributes {
+			if a.name == attr.Name.Local {
+				decl = a
+				break
+			}
+		}
+		if decl == nil {
+			v.violation(f.path, "attribute %s is not allowed", attr.Name.Local)
+			continue
+		}
+		if decl.typ != nil {
+			if err := decl.typ.check(attr.Value); err != nil {
+				v.violation(f.path, "attribute %s: %s", attr.Name.Local, err)
+			}
+		}
+	}
+	for _, a := range f.typ.attributes {
+		if a.required && !found[a.name] {
+			v.violation(f.path, "required attribute %s is missing", a.name)
+		}
+	}
+}
+
+// end checks the content of the innermost element, 'text' is its trimmed text, and pops it from the stack
+func (v *validator) end(text string) {
+	f := v.stack[len(v.stack)-1]
+	v.stack = v.stack[:len(v.stack)-1]
+	t := f.typ
+	if t == nil {
+		return
+	}
+	if !t.complex {
+		if err := t.check(text); err != nil {
+			v.violation(f.path, "%s", err)
+		}
+		return
+	}
+	switch {
+	case t.text != nil:
+		if err := t.text.check(text); err != nil {
+			v.violation(f.path, "%s", err)
+		}
+	case len(text) > 0 && !t.mixed:
+		v.violation(f.path, "text is not allowed")
+	}
+	if len(f.counts) == 0 && t.minGroup == 0 {
+		return
+	}
+	if t.model == "choice" {
+		if len(f.counts) == 0 {
+			var names []string
+			for _, child := range t.children {
+				names = append(names, child.name)
+			}
+			v.violation(f.path, "one of %s is required", strings.Join(names, ", "))
+		}
+		return
+	}
+	for _, child := range t.children {
+		if f.counts[child.name] < child.minOccurs {
+			v.violation(f.path, "required element %s is missing", child.name)
+		}
+	}
+}
+
+// validate starts validating the next element read, if a schema is loaded. 'name' is the local name of the element.
+// In split mode only elements declared as global elements in the schema are validated.
+func (d *decoder) validate(name string, split bool) {
+	if d.codec.schema == nil {
+		return
+	}
+	if _, ok := d.codec.schema.elements[name]; ok || !split {
+		d.validator = &validator{schema: d.codec.schema, max: d.codec.XsdMaxErrors}
+	}
+}
+
+// finishValidation reports the violations found in the document (or split element) and resets the validator.
+// With XsdReject the first violation is returned as an error, otherwise the event is tagged.
+func (d *decoder) finishValidation() error {
+	v := d.validator
+	d.validator = nil
+	if v == nil || len(v.violations) == 0 {
+		return nil
+	}
+	if d.codec.XsdReject {
+		return fmt.Errorf("xsd validation failed: %s", v.violations[0])
+	}
+	d.report.addTag(XsdErrorTag)
+	d.report.setField(d.codec.XsdErrorField, v.violations)
+	return nil
+}
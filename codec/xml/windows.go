@@ -0,0 +1,111 @@
+package xml
+
+import (
+	"strings"
+)
+
+// windowsSystemNames are field names for attributes in the System element, other attributes are named by
+// joining the element and attribute names
+var windowsSystemNames = map[string]string{
+	"Provider.Name":                 "ProviderName",
+	"Provider.Guid":                 "ProviderGuid",
+	"Provider.EventSourceName":      "EventSourceName",
+	"EventID.Qualifiers":            "Qualifiers",
+	"TimeCreated.SystemTime":        "TimeCreated",
+	"Correlation.ActivityID":        "ActivityID",
+	"Correlation.RelatedActivityID": "RelatedActivityID",
+	"Execution.ProcessID":           "ProcessID",
+	"Execution.ThreadID":            "ThreadID",
+	"Security.UserID":               "UserID",
+}
+
+// windowsEvent flattens the System element and turns EventData/Data elements with a Name attribute into named fields.
+// Other parts of the event, like UserData and RenderingInfo, are left as they are. Elements are matched on their
+// local name so all namespace modes work.
+func (c *Codec) windowsEvent(m map[string]interface{}) {
+	event, ok := child(m, "Event").(map[string]interface{})
+	if !ok {
+		return
+	}
+	for key, value := range event {
+		element, ok := value.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		switch stripPrefix(key) {
+		case "System":
+			event[key] = c.windowsSystem(element)
+		case "EventData":
+			event[key] = c.windowsEventData(element)
+		}
+	}
+}
+
+// windowsSystem returns the System element as a flat map. Fields are named by the local name of the element, or
+// the element and attribute names, so they are the same with all namespace modes and with AttrsAsFields.
+func (c *Codec) windowsSystem(system map[string]interface{}) map[string]interface{} {
+	prefix := c.attrKey("")
+	result := make(map[string]interface{}, len(system))
+	for key, value := range system {
+		name := stripPrefix(key)
+		element, ok := value.(map[string]interface{})
+		if !ok {
+			result[name] = value
+			continue
+		}
+		for key, v := range element {
+			if key == c.textKey() {
+				result[name] = v
+				continue
+			}
+			// the elements in System have no children, other keys are attributes
+			attr := stripPrefix(strings.TrimPrefix(key, prefix))
+			if field, ok := windowsSystemNames[name+"."+attr]; ok {
+				result[field] = v
+			} else {
+				result[name+attr] = v
+			}
+		}
+	}
+	return result
+}
+
+// windowsEventData returns EventData with each Data element named by its Name attribute. Data elements without
+// a name are kept in Data.
+func (c *Codec) windowsEventData(data map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(data))
+	var unnamed []interface{}
+	for key, value := range data {
+		if stripPrefix(key) != "Data" {
+			result[key] = value
+			continue
+		}
+		list, ok := value.([]interface{})
+		if !ok {
+			list = []interface{}{value}
+		}
+		for _, item := range list {
+			element, ok := item.(map[string]interface{})
+			if !ok {
+				unnamed = append(unnamed, item)
+				continue
+			}
+			name, ok := element[c.attrKey("Name")].(string)
+			if !ok {
+				unnamed = append(unnamed, item)
+				continue
+			}
+			if text, ok := element[c.textKey()]; ok {
+				result[name] = text
+			} else {
+				result[name] = ""
+			}
+		}
+	}
+	if len(unnamed) == 1 {
+		result["Data"] = unnamed[0]
+	} else if len(unnamed) > 1 {
+		result["Data"] = unnamed
+	}
+	return result
+}
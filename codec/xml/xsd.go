@@ -0,0 +1,524 @@
+package xml
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// XsdErrorTag tag added to event when the document does not validate against the schema
+const XsdErrorTag = "gogstash_codec_xml_xsd_error"
+
+const XsdErrorField = "xsd_errors" // default field for schema violations
+
+const xsdMaxErrors = 10 // default number of violations to report
+
+// The XML Schema support is a subset: global and local elements with sequence, choice and all, minOccurs and
+// maxOccurs, attributes, simpleContent extensions and simple types with restrictions on the built in types.
+// Groups, substitution groups, imports and identity constraints are not supported. Names are matched on the local
+// name, the target namespace is not checked.
+
+// xsdSchema is a compiled schema
+type xsdSchema struct {
+	elements map[string]*xsdElement // global elements
+}
+
+// xsdElement is an element declaration
+type xsdElement struct {
+	name      string
+	typ       *xsdType // nil for any content
+	minOccurs int
+	maxOccurs int // -1 for unbounded
+}
+
+// xsdAttribute is an attribute declaration
+type xsdAttribute struct {
+	name     string
+	typ      *xsdType
+	required bool
+}
+
+// xsdType is a simple or complex type
+type xsdType struct {
+	// simple types
+	builtin      string           // name of the built in type, empty if derived from base
+	base         *xsdType         // type this is a restriction of
+	enumeration  []string         // allowed values
+	patterns     []*regexp.Regexp // values must match all patterns
+	minLength    int              // -1 if not set
+	maxLength    int              // -1 if not set
+	minInclusive *float64
+	maxInclusive *float64
+
+	// complex types
+	complex    bool
+	model      string // sequence, choice or all
+	children   []*xsdElement
+	attributes []*xsdAttribute
+	mixed      bool
+	text       *xsdType // type of text for simpleContent
+	minGroup   int      // minOccurs of the model group
+	ordered    bool     // children must come in order
+}
+
+// raw XSD syntax, used when loading the schema
+
+type rawSchema struct {
+	Elements     []rawElement     `xml:"element"`
+	ComplexTypes []rawComplexType `xml:"complexType"`
+	SimpleTypes  []rawSimpleType  `xml:"simpleType"`
+}
+
+type rawElement struct {
+	Name        string          `xml:"name,attr"`
+	Type        string          `xml:"type,attr"`
+	Ref         string          `xml:"ref,attr"`
+	MinOccurs   string          `xml:"minOccurs,attr"`
+	MaxOccurs   string          `xml:"maxOccurs,attr"`
+	ComplexType *rawComplexType `xml:"complexType"`
+	SimpleType  *rawSimpleType  `xml:"simpleType"`
+}
+
+type rawComplexType struct {
+	Name          string            `xml:"name,attr"`
+	Mixed         bool              `xml:"mixed,attr"`
+	Sequence      *rawGroup         `xml:"sequence"`
+	Choice        *rawGroup         `xml:"choice"`
+	All           *rawGroup         `xml:"all"`
+	Attributes    []rawAttribute    `xml:"attribute"`
+	SimpleContent *rawSimpleContent `xml:"simpleContent"`
+}
+
+type rawGroup struct {
+	MinOccurs string       `xml:"minOccurs,attr"`
+	MaxOccurs string       `xml:"maxOccurs,attr"`
+	Elements  []rawElement `xml:"element"`
+}
+
+type rawAttribute struct {
+	Name       string         `xml:"name,attr"`
+	Type       string         `xml:"type,attr"`
+	Use        string         `xml:"use,attr"`
+	SimpleType *rawSimpleType `xml:"simpleType"`
+}
+
+type rawSimpleContent struct {
+	Extension *rawExtension `xml:"extension"`
+}
+
+type rawExtension struct {
+	Base       string         `xml:"base,attr"`
+	Attributes []rawAttribute `xml:"attribute"`
+}
+
+type rawSimpleType struct {
+	Name        string          `xml:"name,attr"`
+	Restriction *rawRestriction `xml:"restriction"`
+}
+
+type rawRestriction struct {
+	Base         string     `xml:"base,attr"`
+	Enumeration  []rawFacet `xml:"enumeration"`
+	Pattern      []rawFacet `xml:"pattern"`
+	Length       *rawFacet  `xml:"length"`
+	MinLength    *rawFacet  `xml:"minLength"`
+	MaxLength    *rawFacet  `xml:"maxLength"`
+	MinInclusive *rawFacet  `xml:"minInclusive"`
+	MaxInclusive *rawFacet  `xml:"maxInclusive"`
+}
+
+type rawFacet struct {
+	Value string `xml:"value,attr"`
+}
+
+// schemaLoader compiles a raw schema, resolving named types as they are used.
+// Complex types are cached before their children are compiled, so types may refer to themselves.
+type schemaLoader struct {
+	raw     rawSchema
+	types   map[string]*xsdType // compiled named types
+	loading map[string]bool     // named simple types being compiled, to stop on circular definitions
+	refs    []*xsdElement       // element references, resolved when all global elements are compiled
+}
+
+// loadSchema loads the schema in Xsd
+func (c *Codec) loadSchema() (err error) {
+	if len(c.Xsd) == 0 {
+		return nil
+	}
+	if c.XsdMaxErrors <= 0 {
+		return fmt.Errorf("invalid xsd_max_errors %d", c.XsdMaxErrors)
+	}
+	c.schema, err = readSchema(c.Xsd)
+	return err
+}
+
+// readSchema reads and compiles the schema in 'filename'
+func readSchema(filename string) (*xsdSchema, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	l := schemaLoader{
+		types:   make(map[string]*xsdType),
+		loading: make(map[string]bool),
+	}
+	if err = xml.Unmarshal(data, &l.raw); err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	schema := &xsdSchema{elements: make(map[string]*xsdElement)}
+	for i := range l.raw.Elements {
+		e, err := l.element(&l.raw.Elements[i])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", filename, err)
+		}
+		schema.elements[e.name] = e
+	}
+	if len(schema.elements) == 0 {
+		return nil, fmt.Errorf("%s: no elements in schema", filename)
+	}
+	for _, e := range l.refs {
+		global, ok := schema.elements[e.name]
+		if !ok {
+			return nil, fmt.Errorf("%s: unknown element %s", filename, e.name)
+		}
+		e.typ = global.typ
+	}
+	return schema, nil
+}
+
+// localName removes the namespace prefix from a reference
+func localName(name string) string {
+	if idx := strings.Index(name, ":"); idx >= 0 {
+		return name[idx+1:]
+	}
+	return name
+}
+
+// occurs parses minOccurs and maxOccurs, both default to 1
+func occurs(min, max string) (int, int, error) {
+	minOccurs, maxOccurs := 1, 1
+	var err error
+	if len(min) > 0 {
+		if minOccurs, err = strconv.Atoi(min); err != nil {
+			return 0, 0, fmt.Errorf("invalid minOccurs %q", min)
+		}
+	}
+	if max == "unbounded" {
+		maxOccurs = -1
+	} else if len(max) > 0 {
+		if maxOccurs, err = strconv.Atoi(max); err != nil {
+			return 0, 0, fmt.Errorf("invalid maxOccurs %q", max)
+		}
+	}
+	return minOccurs, maxOccurs, nil
+}
+
+// element compiles an element declaration
+func (l *schemaLoader) element(raw *rawElement) (e *xsdElement, err error) {
+	e = &xsdElement{}
+	if e.minOccurs, e.maxOccurs, err = occurs(raw.MinOccurs, raw.MaxOccurs); err != nil {
+		return nil, err
+	}
+	if len(raw.Ref) > 0 {
+		// the type is set from the global element when all are compiled
+		e.name = localName(raw.Ref)
+		l.refs = append(l.refs, e)
+		return e, nil
+	}
+	e.name = raw.Name
+	switch {
+	case raw.ComplexType != nil:
+		e.typ, err = l.complexType(raw.ComplexType)
+	case raw.SimpleType != nil:
+		e.typ, err = l.simpleType(raw.SimpleType)
+	case len(raw.Type) > 0:
+		e.typ, err = l.namedType(raw.Type)
+	}
+	return e, err
+}
+
+// namedType returns a built in type or a type defined in the schema
+func (l *schemaLoader) namedType(name string) (*xsdType, error) {
+	name = localName(name)
+	if t, ok := l.types[name]; ok {
+		return t, nil
+	}
+	for i := range l.raw.ComplexTypes {
+		if raw := &l.raw.ComplexTypes[i]; raw.Name == name {
+			t := newComplexType(raw)
+			l.types[name] = t
+			return t, l.compileComplexType(raw, t)
+		}
+	}
+	if l.loading[name] {
+		return nil, fmt.Errorf("circular definition of type %s", name)
+	}
+	l.loading[name] = true
+	defer delete(l.loading, name)
+	for i := range l.raw.SimpleTypes {
+		if l.raw.SimpleTypes[i].Name == name {
+			t, err := l.simpleType(&l.raw.SimpleTypes[i])
+			l.types[name] = t
+			return t, err
+		}
+	}
+	if name == "anyType" {
+		return nil, nil
+	}
+	if _, ok := builtinTypes[name]; !ok {
+		return nil, fmt.Errorf("unknown type %s", name)
+	}
+	return &xsdType{builtin: name, minLength: -1, maxLength: -1}, nil
+}
+
+// newComplexType returns an empty complex type for 'raw'
+func newComplexType(raw *rawComplexType) *xsdType {
+	return &xsdType{complex: true, mixed: raw.Mixed, minLength: -1, maxLength: -1}
+}
+
+// complexType compiles an anonymous complex type
+func (l *schemaLoader) complexType(raw *rawComplexType) (*xsdType, error) {
+	t := newComplexType(raw)
+	return t, l.compileComplexType(raw, t)
+}
+
+// compileComplexType compiles the content of 'raw' into 't'
+func (l *schemaLoader) compileComplexType(raw *rawComplexType, t *xsdType) (err error) {
+	var group *rawGroup
+	switch {
+	case raw.Sequence != nil:
+		t.model, group, t.ordered = "sequence", raw.Sequence, true
+	case raw.Choice != nil:
+		t.model, group = "choice", raw.Choice
+	case raw.All != nil:
+		t.model, group = "all", raw.All
+	}
+	if group != nil {
+		var maxGroup int
+		if t.minGroup, maxGroup, err = occurs(group.MinOccurs, group.MaxOccurs); err != nil {
+			return err
+		}
+		// a repeated sequence is checked without order
+		if maxGroup != 1 {
+			t.ordered = false
+		}
+		for i := range group.Elements {
+			e, err := l.element(&group.Elements[i])
+			if err != nil {
+				return err
+			}
+			if maxGroup != 1 {
+				e.maxOccurs = -1
+			}
+			t.children = append(t.children, e)
+		}
+	}
+	attributes := raw.Attributes
+	if raw.SimpleContent != nil && raw.SimpleContent.Extension != nil {
+		if t.text, err = l.namedType(raw.SimpleContent.Extension.Base); err != nil {
+			return err
+		}
+		if t.text == nil {
+			t.text = &xsdType{builtin: "string", minLength: -1, maxLength: -1}
+		}
+		attributes = append(attributes, raw.SimpleContent.Extension.Attributes...)
+	}
+	for _, a := range attributes {
+		attr := &xsdAttribute{name: a.Name, required: a.Use == "required"}
+		switch {
+		case a.SimpleType != nil:
+			attr.typ, err = l.simpleType(a.SimpleType)
+		case len(a.Type) > 0:
+			attr.typ, err = l.namedType(a.Type)
+		}
+		if err != nil {
+			return err
+		}
+		t.attributes = append(t.attributes, attr)
+	}
+	return nil
+}
+
+// simpleType compiles a simple type
+func (l *schemaLoader) simpleType(raw *rawSimpleType) (t *xsdType, err error) {
+	t = &xsdType{minLength: -1, maxLength: -1}
+	r := raw.Restriction
+	if r == nil {
+		t.builtin = "string"
+		return t, nil
+	}
+	if t.base, err = l.namedType(r.Base); err != nil {
+		return nil, err
+	}
+	if t.base != nil && t.base.complex {
+		return nil, fmt.Errorf("restriction of complex type %s", r.Base)
+	}
+	for _, e := range r.Enumeration {
+		t.enumeration = append(t.enumeration, e.Value)
+	}
+	for _, p := range r.Pattern {
+		re, err := regexp.Compile("^(?:" + p.Value + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q", p.Value)
+		}
+		t.patterns = append(t.patterns, re)
+	}
+	intFacet := func(f *rawFacet, v *int) error {
+		if f == nil {
+			return nil
+		}
+		n, err := strconv.Atoi(f.Value)
+		if err != nil {
+			return fmt.Errorf("invalid facet value %q", f.Value)
+		}
+		*v = n
+		return nil
+	}
+	floatFacet := func(f *rawFacet) (*float64, error) {
+		if f == nil {
+			return nil, nil
+		}
+		n, err := strconv.ParseFloat(f.Value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid facet value %q", f.Value)
+		}
+		return &n, nil
+	}
+	if err = intFacet(r.Length, &t.minLength); err != nil {
+		return nil, err
+	}
+	_ = intFacet(r.Length, &t.maxLength)
+	if err = intFacet(r.MinLength, &t.minLength); err != nil {
+		return nil, err
+	}
+	if err = intFacet(r.MaxLength, &t.maxLength); err != nil {
+		return nil, err
+	}
+	if t.minInclusive, err = floatFacet(r.MinInclusive); err != nil {
+		return nil, err
+	}
+	if t.maxInclusive, err = floatFacet(r.MaxInclusive); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// builtinTypes are the supported built in simple types and how they are checked
+var builtinTypes = map[string]func(string) bool{
+	"string":             func(string) bool { return true },
+	"normalizedString":   func(string) bool { return true },
+	"token":              func(string) bool { return true },
+	"anySimpleType":      func(string) bool { return true },
+	"anyURI":             func(string) bool { return true },
+	"NMTOKEN":            func(string) bool { return true },
+	"Name":               func(string) bool { return true },
+	"NCName":             func(string) bool { return true },
+	"ID":                 func(string) bool { return true },
+	"IDREF":              func(string) bool { return true },
+	"language":           func(string) bool { return true },
+	"integer":            isInt(0, false),
+	"int":                isInt(32, false),
+	"long":               isInt(64, false),
+	"short":              isInt(16, false),
+	"byte":               isInt(8, false),
+	"nonNegativeInteger": isInt(0, true),
+	"positiveInteger":    func(s string) bool { n, err := strconv.ParseUint(s, 10, 64); return err == nil && n > 0 },
+	"unsignedLong":       isInt(64, true),
+	"unsignedInt":        isInt(32, true),
+	"unsignedShort":      isInt(16, true),
+	"unsignedByte":       isInt(8, true),
+	"decimal":            isFloat,
+	"float":              isFloat,
+	"double":             isFloat,
+	"boolean":            func(s string) bool { return s == "true" || s == "false" || s == "1" || s == "0" },
+	"date":               isTime("2006-01-02", "2006-01-02Z07:00"),
+	"dateTime":           isTime("2006-01-02T15:04:05", time.RFC3339Nano),
+	"time":               isTime("15:04:05", "15:04:05Z07:00"),
+}
+
+// isInt returns a check for integers of 'bits' size, 0 for any size
+func isInt(bits int, unsigned bool) func(string) bool {
+	if bits == 0 {
+		bits = 64
+	}
+	return func(s string) bool {
+		var err error
+		if unsigned {
+			_, err = strconv.ParseUint(s, 10, bits)
+		} else {
+			_, err = strconv.ParseInt(s, 10, bits)
+		}
+		return err == nil
+	}
+}
+
+// isFloat checks decimal numbers
+func isFloat(s string) bool {
+	_, err := strconv.ParseFloat(s, 64)
+	return err == nil
+}
+
+// isTime returns a check for time values in any of 'layouts'
+func isTime(layouts ...string) func(string) bool {
+	return func(s string) bool {
+		for _, layout := range layouts {
+			if _, err := time.Parse(layout, s); err == nil {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// check returns an error if 'value' is not valid for the simple type
+func (t *xsdType) check(value string) error {
+	if t.base != nil {
+		if err := t.base.check(value); err != nil {
+			return err
+		}
+	} else if check, ok := builtinTypes[t.builtin]; ok && !check(strings.TrimSpace(value)) {
+		return fmt.Errorf("%q is not a valid %s", value, t.builtin)
+	}
+	if len(t.enumeration) > 0 {
+		found := false
+		for _, e := range t.enumeration {
+			if e == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%q is not one of %s", value, strings.Join(t.enumeration, ", "))
+		}
+	}
+	for _, p := range t.patterns {
+		if !p.MatchString(value) {
+			return fmt.Errorf("%q does not match pattern %s", value, p.String())
+		}
+	}
+	length := utf8.RuneCountInString(value)
+	if t.minLength >= 0 && length < t.minLength {
+		return fmt.Errorf("%q is shorter than %d", value, t.minLength)
+	}
+	if t.maxLength >= 0 && length > t.maxLength {
+		return fmt.Errorf("%q is longer than %d", value, t.maxLength)
+	}
+	if t.minInclusive != nil || t.maxInclusive != nil {
+		n, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", value)
+		}
+		if t.minInclusive != nil && n < *t.minInclusive {
+			return fmt.Errorf("%q is less than %v", value, *t.minInclusive)
+		}
+		if t.maxInclusive != nil && n > *t.maxInclusive {
+			return fmt.Errorf("%q is greater than %v", value, *t.maxInclusive)
+		}
+	}
+	return nil
+}
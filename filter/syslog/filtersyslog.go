@@ -3,34 +3,67 @@ package syslog
 import (
 	"context"
 	"errors"
+	"fmt"
 	syslog "github.com/influxdata/go-syslog/v3"
 	"github.com/influxdata/go-syslog/v3/rfc3164"
 	"github.com/influxdata/go-syslog/v3/rfc5424"
 	"github.com/tsaikd/gogstash/config"
-	"github.com/tsaikd/gogstash/config/goglog"
 	"github.com/tsaikd/gogstash/config/logevent"
 	"strings"
+	"time"
 )
 
 // ModuleName is the name used in config file
 const ModuleName = "syslog"
 
-const MessageField = "syslog_message" // default field for syslog message
-const HostnameField = "hostname"      // default hostname
-const AppNameField = "appname"        // default appname
-const SeverityField = "severity"      // default severity
-const PriorityField = "priority"      // default priority
-const MessageIdField = "message_id"   // default message id
+const MessageField = "syslog_message"     // default field for syslog message
+const HostnameField = "hostname"          // default hostname
+const AppNameField = "appname"            // default appname
+const SeverityField = "severity"          // default severity
+const PriorityField = "priority"          // default priority
+const FacilityField = "facility"          // default facility
+const MessageIdField = "message_id"       // default message id
+const FormatField = "syslog_format"       // default field for the format that was parsed
+const VersionField = "syslog_version"     // default version
+const ProcIDField = "syslog_proc_id"      // default process id
+const StructuredDataField = "syslog_sd"   // default field for structured data
+const SeverityNameField = "severity_name" // default field for the severity name when both number and name are kept
+const FacilityNameField = "facility_name" // default field for the facility name when both number and name are kept
+
+// Formats for severity and facility, the number, the name (like err or local3, the short syslog(3) names) or both
+const (
+	LevelNumber = "number"
+	LevelText   = "text"
+	LevelBoth   = "both"
+)
+
+// Formats, AUTO tries RFC5424 first and then RFC3164. RAW is recorded when no parser matched and RawFallback is set.
+const (
+	FormatRFC5424 = "RFC5424"
+	FormatRFC3164 = "RFC3164"
+	FormatAuto    = "AUTO"
+	FormatRaw     = "RAW"
+)
 
 // ErrorTag tag added to event when process module failed
 const ErrorTag = "gogstash_filter_syslog_error"
 
+// PartialTag tag added to event when the message was only partially parsed, see BestEffort
+const PartialTag = "syslog_partial"
+
+const ErrorField = "syslog_error" // default field for the parser error
+
 // FilterConfig holds the configuration json fields and internal objects
 type FilterConfig struct {
 	config.FilterConfig
 
 	Source         string `json:"source" yaml:"source"`                 // source message field name
-	Format         string `json:"format" yaml:"format"`                 // input format, either RFC3164 or RFC5424
+	Format         string `json:"format" yaml:"format"`                 // input format, either RFC3164, RFC5424 or AUTO
+	RawFallback    bool   `json:"raw_fallback" yaml:"raw_fallback"`     // if true messages no parser matched are passed on with source as message
+	FormatField    string `json:"format_field" yaml:"format_field"`     // format that was parsed, empty to not record it
+	BestEffort     bool   `json:"best_effort" yaml:"best_effort"`       // if true fields from partially parsed messages are kept
+	ErrorField     string `json:"error_field" yaml:"error_field"`       // error text for failed or partially parsed messages, empty to not record it
+	LogInterval    int    `json:"log_interval" yaml:"log_interval"`     // min number of seconds between logged errors, 0 to log every error
 	SaveTime       bool   `json:"save_time" yaml:"save_time"`           // if true time from syslog is kept
 	RemoveSource   bool   `json:"remove_source" yaml:"remove_source"`   // if true source message is removed (upon success)
 	MessageField   string `json:"message_field" yaml:"message_field"`   // syslog message
@@ -38,9 +71,35 @@ type FilterConfig struct {
 	AppNameField   string `yaml:"app_name_field" json:"app_name_field"` // appname
 	SeverityField  string `json:"severity_field" yaml:"severity_field"`
 	PriorityField  string `json:"priority_field" yaml:"priority_field"`
+	FacilityField  string `json:"facility_field" yaml:"facility_field"` // facility, empty to not record it
 	MessageIdField string `json:"message_id_field" yaml:"message_id_field"`
+	VersionField   string `json:"version_field" yaml:"version_field"` // RFC5424 version, empty to not record it
+	ProcIDField    string `json:"proc_id_field" yaml:"proc_id_field"` // process id, empty to not record it
+
+	SeverityFormat    string `json:"severity_format" yaml:"severity_format"`         // number, text or both
+	SeverityNameField string `json:"severity_name_field" yaml:"severity_name_field"` // field for the severity name when SeverityFormat is both
+	FacilityFormat    string `json:"facility_format" yaml:"facility_format"`         // number, text or both
+	FacilityNameField string `json:"facility_name_field" yaml:"facility_name_field"` // field for the facility name when FacilityFormat is both
 
-	parser syslog.Machine // the parser that parses messages
+	RFC3164Year       string            `json:"rfc3164_year" yaml:"rfc3164_year"`             // year for RFC3164 timestamps, current or closest
+	Timezone          string            `json:"timezone" yaml:"timezone"`                     // timezone for RFC3164 timestamps, default UTC
+	HostTimezones     map[string]string `json:"host_timezones" yaml:"host_timezones"`         // hostname -> timezone, overrides Timezone
+	RFC3339Timestamps bool              `json:"rfc3339_timestamps" yaml:"rfc3339_timestamps"` // accept RFC3339 timestamps in RFC3164 messages
+
+	StructuredDataField string            `json:"sd_field" yaml:"sd_field"`     // RFC5424 structured data, stored as <sd_field>.<SD-ID>.<param>, empty to not record it
+	SDRename            map[string]string `json:"sd_rename" yaml:"sd_rename"`   // SD-ID -> name to store the SD-ELEMENT as
+	SDFlatten           []string          `json:"sd_flatten" yaml:"sd_flatten"` // SD-IDs to store as <sd_field>.<param>
+
+	parsers       []parser                  // the parsers to try, in order
+	errorLog      *rateLog                  // logs errors, limited by LogInterval
+	location      *time.Location            // parsed Timezone
+	hostLocations map[string]*time.Location // parsed HostTimezones
+}
+
+// parser is a syslog parser and the format it parses
+type parser struct {
+	format  string
+	machine syslog.Machine
 }
 
 // DefaultFilterConfig returns an FilterConfig struct with default values
@@ -58,7 +117,22 @@ func DefaultFilterConfig() FilterConfig {
 		AppNameField:   AppNameField,
 		SeverityField:  SeverityField,
 		PriorityField:  PriorityField,
+		FacilityField:  FacilityField,
 		MessageIdField: MessageIdField,
+		FormatField:    FormatField,
+		ErrorField:     ErrorField,
+		LogInterval:    10,
+		VersionField:   VersionField,
+		ProcIDField:    ProcIDField,
+
+		SeverityFormat:    LevelNumber,
+		SeverityNameField: SeverityNameField,
+		FacilityFormat:    LevelNumber,
+		FacilityNameField: FacilityNameField,
+
+		RFC3164Year: YearCurrent,
+
+		StructuredDataField: StructuredDataField,
 	}
 }
 
@@ -70,47 +144,125 @@ func InitHandler(ctx context.Context, raw config.ConfigRaw, control config.Contr
 		return nil, err
 	}
 
+	var options5424, options3164 []syslog.MachineOption
+	if conf.BestEffort {
+		options5424 = append(options5424, rfc5424.WithBestEffort())
+		options3164 = append(options3164, rfc3164.WithBestEffort())
+	}
+	if conf.RFC3339Timestamps {
+		options3164 = append(options3164, rfc3164.WithRFC3339())
+	}
+	if err = conf.initTimezones(); err != nil {
+		return nil, err
+	}
+	conf.errorLog = &rateLog{interval: time.Duration(conf.LogInterval) * time.Second}
+	rfc5424Parser := parser{FormatRFC5424, rfc5424.NewParser(options5424...)}
+	rfc3164Parser := parser{FormatRFC3164, rfc3164.NewParser(options3164...)}
 	conf.Format = strings.ToUpper(conf.Format)
 	switch conf.Format {
-	case "RFC5424":
-		conf.parser = rfc5424.NewParser()
-	case "RFC3164":
-		conf.parser = rfc3164.NewParser()
+	case FormatRFC5424:
+		conf.parsers = []parser{rfc5424Parser}
+	case FormatRFC3164:
+		conf.parsers = []parser{rfc3164Parser}
+	case FormatAuto:
+		conf.parsers = []parser{rfc5424Parser, rfc3164Parser}
 	default:
 		return nil, errors.New("Invalid format")
 	}
+	for _, format := range []string{conf.SeverityFormat, conf.FacilityFormat} {
+		switch format {
+		case LevelNumber, LevelText, LevelBoth:
+		default:
+			return nil, fmt.Errorf("invalid severity or facility format %q", format)
+		}
+	}
 
 	return &conf, nil
 }
 
 // Event the main filter event
 func (f *FilterConfig) Event(ctx context.Context, event logevent.LogEvent) (logevent.LogEvent, bool) {
+	clean := false // true if the message was fully parsed
 	if value, ok := event.Get(f.Source).(string); ok {
-		msg, err := f.parser.Parse([]byte(value))
-		if err != nil {
-			goglog.Logger.Errorf("%s: %s", ModuleName, err.Error())
-			return event, false
-		}
-		if !msg.Valid() {
-			goglog.Logger.Errorf("%s: invalid message", ModuleName)
-			return event, false
+		msg, format, err := f.parse([]byte(value))
+		switch {
+		case err == nil:
+			f.setFormat(format, &event)
+			err = f.setsyslogfields(msg, &event)
+			clean = err == nil
+		case msg != nil:
+			// partially parsed with BestEffort
+			f.setFormat(format, &event)
+			event.AddTag(PartialTag)
+			f.setError(err, &event)
+			err = f.setsyslogfields(msg, &event)
+		case f.RawFallback:
+			// pass the message on as is
+			f.setFormat(FormatRaw, &event)
+			event.SetValue(f.MessageField, value)
+			err = nil
 		}
-		err = f.setsyslogfields(msg, &event)
 		if err != nil {
-			goglog.Logger.Errorf("%s: %s", ModuleName, err.Error())
+			f.fail(err, &event)
 			return event, false
 		}
 	} else {
-		event.AddTag(ErrorTag)
+		f.fail(fmt.Errorf("field %s is not a string", f.Source), &event)
 		return event, false
 	}
-	if f.RemoveSource {
+	// the source is kept when the message was only partially parsed or passed on as is
+	if f.RemoveSource && clean {
 		event.SetValue(f.Source, "")
 		event.Remove(f.Source)
 	}
 	return event, true
 }
 
+// parse tries each parser in turn and returns the first valid message and its format.
+// If no parser succeeds the first partially parsed message is returned together with its error.
+func (f *FilterConfig) parse(data []byte) (msg syslog.Message, format string, err error) {
+	var partial syslog.Message
+	var partialFormat string
+	var partialErr error
+	for _, p := range f.parsers {
+		msg, err = p.machine.Parse(data)
+		if err == nil && !msg.Valid() {
+			err = errors.New("invalid message")
+		}
+		if err == nil {
+			return msg, p.format, nil
+		}
+		if msg != nil && partial == nil {
+			partial, partialFormat, partialErr = msg, p.format, err
+		}
+	}
+	if partial != nil {
+		return partial, partialFormat, partialErr
+	}
+	return nil, "", err
+}
+
+// fail tags the event with ErrorTag, records 'err' and logs it
+func (f *FilterConfig) fail(err error, event *logevent.LogEvent) {
+	event.AddTag(ErrorTag)
+	f.setError(err, event)
+	f.errorLog.Errorf("%s: %s", ModuleName, err.Error())
+}
+
+// setError records 'err' in ErrorField
+func (f *FilterConfig) setError(err error, event *logevent.LogEvent) {
+	if len(f.ErrorField) > 0 {
+		event.SetValue(f.ErrorField, err.Error())
+	}
+}
+
+// setFormat records the format that was parsed
+func (f *FilterConfig) setFormat(format string, event *logevent.LogEvent) {
+	if len(f.FormatField) > 0 {
+		event.SetValue(f.FormatField, format)
+	}
+}
+
 // setsyslogfields add fields for each part of the message
 func (f *FilterConfig) setsyslogfields(message syslog.Message, event *logevent.LogEvent) (err error) {
 	var msg syslog.Base
@@ -119,8 +271,18 @@ func (f *FilterConfig) setsyslogfields(message syslog.Message, event *logevent.L
 		msg = *t
 	case *rfc5424.SyslogMessage:
 		msg = t.Base
+		if len(f.VersionField) > 0 {
+			event.SetValue(f.VersionField, t.Version)
+		}
+		if t.StructuredData != nil && len(f.StructuredDataField) > 0 {
+			event.SetValue(f.StructuredDataField, f.structuredData(*t.StructuredData))
+		}
 	case *rfc3164.SyslogMessage:
 		msg = t.Base
+		if msg.Timestamp != nil {
+			timestamp := f.rfc3164Time(*msg.Timestamp, msg.Hostname)
+			msg.Timestamp = &timestamp
+		}
 	default:
 		return errors.New("incorrect syslog data format")
 	}
@@ -144,7 +306,11 @@ func (f *FilterConfig) setsyslogfields(message syslog.Message, event *logevent.L
 	}
 	// severity
 	if msg.Severity != nil {
-		event.SetValue(f.SeverityField, *msg.Severity)
+		setLevel(event, f.SeverityFormat, f.SeverityField, f.SeverityNameField, *msg.Severity, message.SeverityShortLevel())
+	}
+	// facility
+	if msg.Facility != nil && len(f.FacilityField) > 0 {
+		setLevel(event, f.FacilityFormat, f.FacilityField, f.FacilityNameField, *msg.Facility, message.FacilityLevel())
 	}
 	// priority
 	if msg.Priority != nil {
@@ -154,5 +320,50 @@ func (f *FilterConfig) setsyslogfields(message syslog.Message, event *logevent.L
 	if msg.MsgID != nil {
 		event.SetValue(f.MessageIdField, *msg.MsgID)
 	}
+	// process id
+	if msg.ProcID != nil && len(f.ProcIDField) > 0 {
+		event.SetValue(f.ProcIDField, *msg.ProcID)
+	}
 	return
 }
+
+// setLevel sets severity or facility as number, name or both according to 'format'
+func setLevel(event *logevent.LogEvent, format, field, nameField string, number uint8, name *string) {
+	switch {
+	case format == LevelNumber || name == nil:
+		event.SetValue(field, number)
+	case format == LevelText:
+		event.SetValue(field, *name)
+	default:
+		event.SetValue(field, number)
+		if len(nameField) > 0 {
+			event.SetValue(nameField, *name)
+		}
+	}
+}
+
+// structuredData returns the SD-ELEMENTs as a map, SD-ID -> param -> value
+func (f *FilterConfig) structuredData(data map[string]map[string]string) map[string]interface{} {
+	result := make(map[string]interface{})
+	for id, params := range data {
+		flatten := false
+		for _, v := range f.SDFlatten {
+			if v == id {
+				flatten = true
+				break
+			}
+		}
+		element := result
+		if !flatten {
+			if name, ok := f.SDRename[id]; ok {
+				id = name
+			}
+			element = make(map[string]interface{}, len(params))
+			result[id] = element
+		}
+		for param, value := range params {
+			element[param] = value
+		}
+	}
+	return result
+}
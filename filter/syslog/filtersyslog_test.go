@@ -0,0 +1,280 @@
+package syslog
+
+import (
+	"context"
+	"github.com/tsaikd/gogstash/config"
+	"github.com/tsaikd/gogstash/config/logevent"
+	"testing"
+	"time"
+)
+
+const (
+	testRFC5424 = `<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog 1234 ID47 [exampleSDID@32473 iut="3" eventSource="Application" eventID="1011"][examplePriority@32473 class="high"] An application event log entry...`
+	testRFC3164 = `<34>Oct 11 22:14:15 mymachine su: 'su root' failed for lonvick on /dev/pts/8`
+	testRaw     = `just some text`
+)
+
+// newTestFilter returns a filter initialized from 'raw'
+func newTestFilter(t *testing.T, raw config.ConfigRaw) *FilterConfig {
+	t.Helper()
+	f, err := InitHandler(context.Background(), raw, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f.(*FilterConfig)
+}
+
+// testEvent returns an event with 'message' as message
+func testEvent(message string) logevent.LogEvent {
+	event := logevent.LogEvent{}
+	event.SetValue("message", message)
+	return event
+}
+
+func TestFilterConfig_Format(t *testing.T) {
+	type check struct {
+		name    string
+		format  string
+		raw     bool
+		message string
+		ok      bool
+		parsed  string // expected format field
+		host    string // expected hostname
+	}
+	checks := []check{
+		{"rfc5424", FormatRFC5424, false, testRFC5424, true, FormatRFC5424, "mymachine.example.com"},
+		{"rfc5424 with rfc3164", FormatRFC5424, false, testRFC3164, false, "", ""},
+		{"rfc3164", FormatRFC3164, false, testRFC3164, true, FormatRFC3164, "mymachine"},
+		{"auto rfc5424", "auto", false, testRFC5424, true, FormatRFC5424, "mymachine.example.com"},
+		{"auto rfc3164", "auto", false, testRFC3164, true, FormatRFC3164, "mymachine"},
+		{"auto raw", "auto", false, testRaw, false, "", ""},
+		{"auto raw fallback", "auto", true, testRaw, true, FormatRaw, ""},
+	}
+	for _, c := range checks {
+		t.Run(c.name, func(t *testing.T) {
+			f := newTestFilter(t, config.ConfigRaw{"format": c.format, "raw_fallback": c.raw})
+			event, ok := f.Event(context.Background(), testEvent(c.message))
+			if ok != c.ok {
+				t.Fatalf("expected %v, got %v", c.ok, ok)
+			}
+			if got := event.GetString(FormatField); got != c.parsed {
+				t.Errorf("expected format %q, got %q", c.parsed, got)
+			}
+			if got := event.GetString(HostnameField); got != c.host {
+				t.Errorf("expected hostname %q, got %q", c.host, got)
+			}
+			if c.raw && event.GetString(MessageField) != c.message {
+				t.Errorf("expected message %q, got %q", c.message, event.GetString(MessageField))
+			}
+		})
+	}
+}
+
+func TestFilterConfig_StructuredData(t *testing.T) {
+	f := newTestFilter(t, config.ConfigRaw{
+		"sd_rename":  map[string]interface{}{"exampleSDID@32473": "example"},
+		"sd_flatten": []interface{}{"examplePriority@32473"},
+	})
+	event, ok := f.Event(context.Background(), testEvent(testRFC5424))
+	if !ok {
+		t.Fatal("expected message to be parsed")
+	}
+	checks := map[string]string{
+		StructuredDataField + ".example.iut":         "3",
+		StructuredDataField + ".example.eventSource": "Application",
+		StructuredDataField + ".class":               "high",
+		ProcIDField:                                  "1234",
+		MessageIdField:                               "ID47",
+	}
+	for field, want := range checks {
+		if got := event.GetString(field); got != want {
+			t.Errorf("%s: expected %q, got %v", field, want, event.Get(field))
+		}
+	}
+	if version, ok := event.Get(VersionField).(uint16); !ok || version != 1 {
+		t.Errorf("expected version 1, got %v", event.Get(VersionField))
+	}
+}
+
+func TestFilterConfig_DisabledFields(t *testing.T) {
+	f := newTestFilter(t, config.ConfigRaw{"version_field": "", "proc_id_field": "", "sd_field": ""})
+	event := testEvent(testRFC5424)
+	event.SetValue("version", "app-2.3.1")
+	event, ok := f.Event(context.Background(), event)
+	if !ok {
+		t.Fatal("expected message to be parsed")
+	}
+	if _, found := event.Extra[""]; found {
+		t.Errorf("empty field name was written: %v", event.Extra)
+	}
+	if event.Get(ProcIDField) != nil || event.Get(StructuredDataField) != nil || event.Get(VersionField) != nil {
+		t.Errorf("disabled fields were written: %v", event.Extra)
+	}
+	// the defaults do not clash with fields from the application
+	f = newTestFilter(t, config.ConfigRaw{})
+	event = testEvent(testRFC5424)
+	event.SetValue("version", "app-2.3.1")
+	if event, _ = f.Event(context.Background(), event); event.GetString("version") != "app-2.3.1" {
+		t.Errorf("version field was overwritten: %v", event.Get("version"))
+	}
+}
+
+func TestFilterConfig_Levels(t *testing.T) {
+	type check struct {
+		format   string
+		severity interface{}
+		facility interface{}
+		names    bool // expect name fields
+	}
+	// <34> is facility 4 (auth) and severity 2 (crit)
+	checks := []check{
+		{LevelNumber, uint8(2), uint8(4), false},
+		{LevelText, "crit", "auth", false},
+		{LevelBoth, uint8(2), uint8(4), true},
+	}
+	for _, c := range checks {
+		t.Run(c.format, func(t *testing.T) {
+			f := newTestFilter(t, config.ConfigRaw{"format": FormatRFC3164, "severity_format": c.format, "facility_format": c.format})
+			event, ok := f.Event(context.Background(), testEvent(testRFC3164))
+			if !ok {
+				t.Fatal("expected message to be parsed")
+			}
+			if got := event.Get(SeverityField); got != c.severity {
+				t.Errorf("expected severity %v, got %v", c.severity, got)
+			}
+			if got := event.Get(FacilityField); got != c.facility {
+				t.Errorf("expected facility %v, got %v", c.facility, got)
+			}
+			if names := event.GetString(SeverityNameField) == "crit" && event.GetString(FacilityNameField) == "auth"; names != c.names {
+				t.Errorf("unexpected name fields in %v", event.Extra)
+			}
+		})
+	}
+	// an empty field name disables the facility
+	f := newTestFilter(t, config.ConfigRaw{"format": FormatRFC3164, "facility_field": "", "facility_format": LevelBoth, "facility_name_field": ""})
+	event, _ := f.Event(context.Background(), testEvent(testRFC3164))
+	if _, found := event.Extra[""]; found || event.Get(FacilityField) != nil {
+		t.Errorf("facility was written: %v", event.Extra)
+	}
+	if _, err := InitHandler(context.Background(), config.ConfigRaw{"severity_format": "roman"}, nil); err == nil {
+		t.Error("expected error for invalid severity_format")
+	}
+}
+
+func TestFilterConfig_BestEffort(t *testing.T) {
+	// the structured data is cut short
+	const partial = `<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog 1234 ID47 [exampleSDID@32473 iut="3"`
+	for _, bestEffort := range []bool{false, true} {
+		f := newTestFilter(t, config.ConfigRaw{"format": "auto", "best_effort": bestEffort, "remove_source": true})
+		event, ok := f.Event(context.Background(), testEvent(partial))
+		if ok != bestEffort {
+			t.Fatalf("best_effort %v: expected %v, got %v", bestEffort, bestEffort, ok)
+		}
+		if !bestEffort {
+			continue
+		}
+		if got := event.GetString(HostnameField); got != "mymachine.example.com" {
+			t.Errorf("expected hostname, got %q", got)
+		}
+		if len(event.Tags) != 1 || event.Tags[0] != PartialTag {
+			t.Errorf("expected partial tag, got %v", event.Tags)
+		}
+		if len(event.GetString(ErrorField)) == 0 {
+			t.Errorf("expected parser error in %v", event.Extra)
+		}
+		if got := event.GetString(FormatField); got != FormatRFC5424 {
+			t.Errorf("expected format %s, got %q", FormatRFC5424, got)
+		}
+		// the raw line is kept as the message was not fully parsed
+		if event.Message != partial {
+			t.Errorf("source was removed from a partially parsed message: %q", event.Message)
+		}
+	}
+	// a fully parsed message has its source removed
+	f := newTestFilter(t, config.ConfigRaw{"format": "auto", "best_effort": true, "remove_source": true})
+	if event, _ := f.Event(context.Background(), testEvent(testRFC5424)); event.Message != "" {
+		t.Errorf("expected source to be removed, got %q", event.Message)
+	}
+}
+
+func TestStampTime(t *testing.T) {
+	stamp := func(value string) time.Time {
+		ts, err := time.Parse(time.Stamp, value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ts
+	}
+	newYear := time.Date(2027, 1, 1, 0, 5, 0, 0, time.UTC)
+	type check struct {
+		stamp string
+		year  string
+		now   time.Time
+		want  time.Time
+	}
+	checks := []check{
+		{"Dec 31 23:59:00", YearCurrent, newYear, time.Date(2027, 12, 31, 23, 59, 0, 0, time.UTC)},
+		{"Dec 31 23:59:00", YearClosest, newYear, time.Date(2026, 12, 31, 23, 59, 0, 0, time.UTC)},
+		{"Jan  1 00:01:00", YearClosest, time.Date(2026, 12, 31, 23, 59, 0, 0, time.UTC), time.Date(2027, 1, 1, 0, 1, 0, 0, time.UTC)},
+		{"Jun 15 12:00:00", YearClosest, newYear, time.Date(2027, 6, 15, 12, 0, 0, 0, time.UTC)},
+	}
+	for _, c := range checks {
+		if got := stampTime(stamp(c.stamp), time.UTC, c.year, c.now); !got.Equal(c.want) {
+			t.Errorf("%s %s: expected %v, got %v", c.stamp, c.year, c.want, got)
+		}
+	}
+}
+
+func TestFilterConfig_Timezone(t *testing.T) {
+	f := newTestFilter(t, config.ConfigRaw{
+		"format":         FormatRFC3164,
+		"save_time":      true,
+		"timezone":       "Europe/Oslo",
+		"host_timezones": map[string]interface{}{"tokyo": "Asia/Tokyo"},
+	})
+	for host, zone := range map[string]string{"mymachine": "Europe/Oslo", "tokyo": "Asia/Tokyo"} {
+		event, ok := f.Event(context.Background(), testEvent("<34>Oct 11 22:14:15 "+host+" su: failed"))
+		if !ok {
+			t.Fatal("expected message to be parsed")
+		}
+		loc, _ := time.LoadLocation(zone)
+		want := time.Date(time.Now().Year(), 10, 11, 22, 14, 15, 0, loc)
+		if !event.Timestamp.Equal(want) {
+			t.Errorf("%s: expected %v, got %v", host, want, event.Timestamp)
+		}
+	}
+	f = newTestFilter(t, config.ConfigRaw{"format": FormatRFC3164, "save_time": true, "timezone": "Europe/Oslo", "rfc3339_timestamps": true})
+	event, ok := f.Event(context.Background(), testEvent("<34>2025-10-11T22:14:15Z mymachine su: failed"))
+	if want := time.Date(2025, 10, 11, 22, 14, 15, 0, time.UTC); !ok || !event.Timestamp.Equal(want) {
+		t.Errorf("expected %v, got %v", want, event.Timestamp)
+	}
+	if _, err := InitHandler(context.Background(), config.ConfigRaw{"rfc3164_year": "last"}, nil); err == nil {
+		t.Error("expected error for invalid rfc3164_year")
+	}
+}
+
+func TestFilterConfig_Errors(t *testing.T) {
+	f := newTestFilter(t, config.ConfigRaw{"format": FormatRFC5424, "source": "payload"})
+	invalid := logevent.LogEvent{}
+	invalid.SetValue("payload", testRaw)
+	for name, event := range map[string]logevent.LogEvent{"invalid": invalid, "missing source": {}} {
+		event, ok := f.Event(context.Background(), event)
+		if ok {
+			t.Fatalf("%s: expected failure", name)
+		}
+		if len(event.Tags) != 1 || event.Tags[0] != ErrorTag {
+			t.Errorf("%s: expected error tag, got %v", name, event.Tags)
+		}
+		if len(event.GetString(ErrorField)) == 0 {
+			t.Errorf("%s: expected error in %v", name, event.Extra)
+		}
+	}
+	// the missing source is reported as such, not as a parser error
+	event, _ := f.Event(context.Background(), logevent.LogEvent{})
+	if got := event.GetString(ErrorField); got != "field payload is not a string" {
+		t.Errorf("expected missing source error, got %q", got)
+	}
+	if f.errorLog.suppressed != 2 {
+		t.Errorf("expected 2 errors not logged, got %d", f.errorLog.suppressed)
+	}
+}
@@ -0,0 +1,34 @@
+package syslog
+
+import (
+	"fmt"
+	"github.com/tsaikd/gogstash/config/goglog"
+	"sync"
+	"time"
+)
+
+// rateLog logs errors at most once every interval, and counts the errors that are not logged
+type rateLog struct {
+	mu         sync.Mutex
+	interval   time.Duration // 0 to log every error
+	next       time.Time     // when the next error can be logged
+	suppressed int           // errors not logged since the last one
+}
+
+// Errorf logs the error if the interval since the last logged error has passed
+func (r *rateLog) Errorf(format string, args ...interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	if now.Before(r.next) {
+		r.suppressed++
+		return
+	}
+	msg := fmt.Sprintf(format, args...)
+	if r.suppressed > 0 {
+		msg = fmt.Sprintf("%s (%d more errors not logged)", msg, r.suppressed)
+	}
+	goglog.Logger.Error(msg)
+	r.next = now.Add(r.interval)
+	r.suppressed = 0
+}
@@ -0,0 +1,77 @@
+package syslog
+
+import (
+	"fmt"
+	"time"
+)
+
+// Strategies for the year of RFC3164 timestamps, they have no year
+const (
+	YearCurrent = "current" // the current year
+	YearClosest = "closest" // the year that puts the timestamp closest to now, handles messages sent around New Year
+)
+
+// The year and timezone of RFC3164 timestamps are not set with the rfc3164.WithYear and rfc3164.WithTimezone
+// options: the year is calculated once when the parser is created and the timezone converts the time instead of
+// placing it in the zone. Instead the parser returns the timestamp in year 0 and UTC, and it is fixed after parsing.
+
+// initTimezones loads the timezones and checks the year strategy
+func (f *FilterConfig) initTimezones() (err error) {
+	switch f.RFC3164Year {
+	case YearCurrent, YearClosest:
+	default:
+		return fmt.Errorf("invalid rfc3164_year %q", f.RFC3164Year)
+	}
+	if f.location, err = time.LoadLocation(f.Timezone); err != nil {
+		return err
+	}
+	f.hostLocations = make(map[string]*time.Location, len(f.HostTimezones))
+	for host, name := range f.HostTimezones {
+		loc, err := time.LoadLocation(name)
+		if err != nil {
+			return fmt.Errorf("timezone for %s: %w", host, err)
+		}
+		f.hostLocations[host] = loc
+	}
+	return nil
+}
+
+// rfc3164Time places 't' from a RFC3164 timestamp in the year and timezone for 'hostname'.
+// Timestamps with a year are RFC3339 timestamps (see RFC3339Timestamps) and are kept as they are.
+func (f *FilterConfig) rfc3164Time(t time.Time, hostname *string) time.Time {
+	if t.Year() != 0 {
+		return t
+	}
+	loc := f.location
+	if hostname != nil {
+		if hostLoc, ok := f.hostLocations[*hostname]; ok {
+			loc = hostLoc
+		}
+	}
+	return stampTime(t, loc, f.RFC3164Year, time.Now())
+}
+
+// stampTime returns the time with the wall clock of 't' in 'loc', in the year given by 'year' relative to 'now'
+func stampTime(t time.Time, loc *time.Location, year string, now time.Time) time.Time {
+	now = now.In(loc)
+	date := func(year int) time.Time {
+		return time.Date(year, t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), loc)
+	}
+	result := date(now.Year())
+	if year == YearClosest {
+		for _, candidate := range []time.Time{date(now.Year() - 1), date(now.Year() + 1)} {
+			if abs(candidate.Sub(now)) < abs(result.Sub(now)) {
+				result = candidate
+			}
+		}
+	}
+	return result
+}
+
+// abs returns the absolute value of 'd'
+func abs(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
@@ -0,0 +1,94 @@
+package xml
+
+import (
+	"context"
+	"errors"
+	codecxml "github.com/helgeolav/gogstash-playground/codec/xml"
+	"github.com/tsaikd/gogstash/config"
+	"github.com/tsaikd/gogstash/config/goglog"
+	"github.com/tsaikd/gogstash/config/logevent"
+)
+
+// ModuleName is the name used in config file
+const ModuleName = "xml"
+
+// ErrorTag tag added to event when process module failed
+const ErrorTag = "gogstash_filter_xml_error"
+
+// FilterConfig holds the configuration json fields and internal objects.
+// All decoding options from the xml codec, like try_cast, types, fields and namespaces, can also be used.
+type FilterConfig struct {
+	config.FilterConfig
+
+	Source       string `json:"source" yaml:"source"`               // source message field name
+	Target       string `json:"target" yaml:"target"`               // field to store the document in, empty for top level
+	RemoveSource bool   `json:"remove_source" yaml:"remove_source"` // if true source message is removed (upon success)
+
+	codec *codecxml.Codec // the codec that decodes the XML
+}
+
+// DefaultFilterConfig returns an FilterConfig struct with default values
+func DefaultFilterConfig() FilterConfig {
+	return FilterConfig{
+		FilterConfig: config.FilterConfig{
+			CommonConfig: config.CommonConfig{
+				Type: ModuleName,
+			},
+		},
+		Source: "message",
+	}
+}
+
+// InitHandler initialize the filter plugin
+func InitHandler(ctx context.Context, raw config.ConfigRaw, control config.Control) (config.TypeFilterConfig, error) {
+	conf := DefaultFilterConfig()
+	err := config.ReflectConfig(raw, &conf)
+	if err != nil {
+		return nil, err
+	}
+
+	codec, err := codecxml.InitHandler(ctx, raw)
+	if err != nil {
+		return nil, err
+	}
+	conf.codec = codec.(*codecxml.Codec)
+	if len(conf.codec.SplitPath) > 0 {
+		return nil, errors.New("split_path is not supported in filter")
+	}
+	// decoding errors must be returned so the source is kept and the event is tagged with ErrorTag
+	if conf.codec.OnError != codecxml.OnErrorDrop {
+		return nil, errors.New("on_error is not supported in filter")
+	}
+	conf.codec.Target = conf.Target
+
+	return &conf, nil
+}
+
+// Event the main filter event
+func (f *FilterConfig) Event(ctx context.Context, event logevent.LogEvent) (logevent.LogEvent, bool) {
+	var data []byte
+	switch value := event.Get(f.Source).(type) {
+	case string:
+		data = []byte(value)
+	case []byte:
+		data = value
+	default:
+		event.AddTag(ErrorTag)
+		return event, false
+	}
+	if len(data) == 0 {
+		event.AddTag(ErrorTag)
+		return event, false
+	}
+	err := f.codec.DecodeEvent(data, &event)
+	if err != nil {
+		goglog.Logger.Errorf("%s: %s", ModuleName, err.Error())
+		event.AddTag(ErrorTag)
+		return event, false
+	}
+	if f.RemoveSource {
+		event.SetValue(f.Source, "")
+		event.Remove(f.Source)
+	}
+	return event, true
+}
@@ -0,0 +1,62 @@
+package xml
+
+import (
+	"context"
+	"github.com/tsaikd/gogstash/config"
+	"github.com/tsaikd/gogstash/config/logevent"
+	"testing"
+)
+
+// newTestFilter returns a filter initialized from 'raw'
+func newTestFilter(t *testing.T, raw config.ConfigRaw) *FilterConfig {
+	t.Helper()
+	f, err := InitHandler(context.Background(), raw, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f.(*FilterConfig)
+}
+
+func TestFilterConfig_Event(t *testing.T) {
+	f := newTestFilter(t, config.ConfigRaw{"source": "payload", "target": "doc", "remove_source": true})
+	event := logevent.LogEvent{Message: "original"}
+	event.SetValue("payload", `<order><id>1</id></order>`)
+	event, ok := f.Event(context.Background(), event)
+	if !ok {
+		t.Fatalf("expected success, got tags %v", event.Tags)
+	}
+	if got := event.GetString("doc.order.id"); got != "1" {
+		t.Errorf("expected doc.order.id 1, got %v", event.Extra)
+	}
+	if event.Get("payload") != nil || event.Message != "original" {
+		t.Errorf("unexpected event %q %v", event.Message, event.Extra)
+	}
+}
+
+func TestFilterConfig_Error(t *testing.T) {
+	f := newTestFilter(t, config.ConfigRaw{"source": "payload", "remove_source": true})
+	for name, payload := range map[string]interface{}{"broken": "<broken>", "missing": nil, "empty": ""} {
+		event := logevent.LogEvent{Message: "original"}
+		if payload != nil {
+			event.SetValue("payload", payload)
+		}
+		event, ok := f.Event(context.Background(), event)
+		if ok {
+			t.Errorf("%s: expected failure", name)
+		}
+		if len(event.Tags) != 1 || event.Tags[0] != ErrorTag {
+			t.Errorf("%s: expected error tag, got %v", name, event.Tags)
+		}
+		if event.Message != "original" || event.Get("payload") != payload {
+			t.Errorf("%s: event was changed: %q %v", name, event.Message, event.Extra)
+		}
+	}
+}
+
+func TestInitHandler(t *testing.T) {
+	for _, raw := range []config.ConfigRaw{{"split_path": "a.b"}, {"on_error": "tag"}} {
+		if _, err := InitHandler(context.Background(), raw, nil); err == nil {
+			t.Errorf("expected error for %v", raw)
+		}
+	}
+}
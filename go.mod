@@ -3,14 +3,17 @@ module github.com/helgeolav/gogstash-playground
 go 1.17
 
 require (
+	bitbucket.org/HelgeOlav/geoiplookup v0.0.0-20220107104856-b3cab3aa1df0
+	bitbucket.org/HelgeOlav/utils v0.0.0-20230317220606-7be9fb975a5c
 	github.com/clbanning/mxj/v2 v2.5.5
 	github.com/influxdata/go-syslog/v3 v3.0.0
+	github.com/tsaikd/KDGoLib v0.0.0-20211113074651-c6ea6ab4ee08
 	github.com/tsaikd/gogstash v0.0.0-20230330063223-4263fc58773e
+	golang.org/x/text v0.8.0
+	google.golang.org/grpc v1.53.0
 )
 
 require (
-	bitbucket.org/HelgeOlav/geoiplookup v0.0.0-20220107104856-b3cab3aa1df0 // indirect
-	bitbucket.org/HelgeOlav/utils v0.0.0-20230317220606-7be9fb975a5c // indirect
 	cloud.google.com/go v0.110.0 // indirect
 	cloud.google.com/go/compute v1.18.0 // indirect
 	cloud.google.com/go/iam v0.12.0 // indirect
@@ -74,6 +77,7 @@ require (
 	github.com/json-iterator/go v1.1.12 // indirect
 	github.com/kardianos/osext v0.0.0-20190222173326-2bc1f35cddc0 // indirect
 	github.com/klauspost/compress v1.16.3 // indirect
+	github.com/leodido/ragel-machinery v0.0.0-20181214104525-299bdde78165 // indirect
 	github.com/lib/pq v1.10.7 // indirect
 	github.com/libp2p/go-reuseport v0.2.0 // indirect
 	github.com/magiconair/properties v1.8.7 // indirect
@@ -122,7 +126,6 @@ require (
 	github.com/subchen/go-trylock/v2 v2.0.0 // indirect
 	github.com/subosito/gotenv v1.4.2 // indirect
 	github.com/tengattack/jodatime v0.0.0-20180920000830-48b203d08145 // indirect
-	github.com/tsaikd/KDGoLib v0.0.0-20211113074651-c6ea6ab4ee08 // indirect
 	github.com/ua-parser/uap-go v0.0.0-20211112212520-00c877edfe0f // indirect
 	github.com/vjeantet/grok v1.0.1 // indirect
 	github.com/xdg/scram v1.0.5 // indirect
@@ -134,13 +137,11 @@ require (
 	golang.org/x/oauth2 v0.5.0 // indirect
 	golang.org/x/sync v0.1.0 // indirect
 	golang.org/x/sys v0.6.0 // indirect
-	golang.org/x/text v0.8.0 // indirect
 	golang.org/x/tools v0.7.0 // indirect
 	golang.org/x/xerrors v0.0.0-20220907171357-04be3eba64a2 // indirect
 	google.golang.org/api v0.110.0 // indirect
 	google.golang.org/appengine v1.6.7 // indirect
 	google.golang.org/genproto v0.0.0-20230306155012-7f2fa6fef1f4 // indirect
-	google.golang.org/grpc v1.53.0 // indirect
 	google.golang.org/protobuf v1.30.0 // indirect
 	gopkg.in/alexcesaro/quotedprintable.v3 v3.0.0-20150716171945-2caba252f4dc // indirect
 	gopkg.in/gomail.v2 v2.0.0-20160411212932-81ebce5c23df // indirect
@@ -0,0 +1,314 @@
+package syslog
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	filtersyslog "github.com/helgeolav/gogstash-playground/filter/syslog"
+	"github.com/influxdata/go-syslog/v3/nontransparent"
+	"github.com/tsaikd/gogstash/config"
+	"github.com/tsaikd/gogstash/config/goglog"
+	"github.com/tsaikd/gogstash/config/logevent"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ModuleName is the name used in config file
+const ModuleName = "syslog"
+
+const PeerField = "peer"         // default field for the address of the sender
+const ListenerField = "listener" // default field for the address we received the message on
+
+// Sockets to listen on
+const (
+	SocketUDP = "udp"
+	SocketTCP = "tcp"
+	SocketTLS = "tls"
+)
+
+// Framing of messages on TCP and TLS (RFC6587), auto detects the framing of each message
+const (
+	FramingAuto           = "auto"
+	FramingOctetCounting  = "octet-counting"
+	FramingNonTransparent = "non-transparent"
+)
+
+var errFrame = errors.New("invalid octet-counting frame")
+
+// InputConfig holds the configuration json fields and internal objects
+type InputConfig struct {
+	config.InputConfig
+
+	Address        string `json:"address" yaml:"address"`                   // address to listen on
+	Socket         string `json:"socket" yaml:"socket"`                     // udp, tcp or tls
+	CertFile       string `json:"cert_file" yaml:"cert_file"`               // server certificate for tls
+	KeyFile        string `json:"key_file" yaml:"key_file"`                 // server key for tls
+	CAFile         string `json:"ca_file" yaml:"ca_file"`                   // if set clients must have a certificate signed by this CA
+	Framing        string `json:"framing" yaml:"framing"`                   // framing on tcp and tls, auto, octet-counting or non-transparent
+	Trailer        string `json:"trailer" yaml:"trailer"`                   // end of message for non-transparent framing, LF or NUL
+	MaxMessageSize int    `json:"max_message_size" yaml:"max_message_size"` // max size of a message
+	PeerField      string `json:"peer_field" yaml:"peer_field"`             // address of the sender
+	ListenerField  string `json:"listener_field" yaml:"listener_field"`     // address we received the message on
+
+	filter    *filtersyslog.FilterConfig // parses messages when no codec is configured
+	trailer   byte                       // parsed Trailer
+	tlsConfig *tls.Config                // server config for tls
+	listener  string                     // address we listen on, set when started
+}
+
+// DefaultInputConfig returns an InputConfig struct with default values
+func DefaultInputConfig() InputConfig {
+	return InputConfig{
+		InputConfig: config.InputConfig{
+			CommonConfig: config.CommonConfig{
+				Type: ModuleName,
+			},
+		},
+		Address:        ":514",
+		Socket:         SocketUDP,
+		Framing:        FramingAuto,
+		Trailer:        "LF",
+		MaxMessageSize: 64 * 1024,
+		PeerField:      PeerField,
+		ListenerField:  ListenerField,
+	}
+}
+
+// InitHandler initialize the input plugin.
+// Messages are decoded with the codec if one is configured, otherwise they are parsed as the syslog filter does,
+// with the same options.
+func InitHandler(ctx context.Context, raw config.ConfigRaw, control config.Control) (config.TypeInputConfig, error) {
+	conf := DefaultInputConfig()
+	err := config.ReflectConfig(raw, &conf)
+	if err != nil {
+		return nil, err
+	}
+
+	switch conf.Socket {
+	case SocketUDP, SocketTCP:
+	case SocketTLS:
+		if conf.tlsConfig, err = conf.loadTLS(); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("invalid socket %q", conf.Socket)
+	}
+	switch conf.Framing {
+	case FramingAuto, FramingOctetCounting, FramingNonTransparent:
+	default:
+		return nil, fmt.Errorf("invalid framing %q", conf.Framing)
+	}
+	trailer, err := nontransparent.TrailerTypeFromString(conf.Trailer)
+	if err != nil {
+		return nil, fmt.Errorf("invalid trailer %q", conf.Trailer)
+	}
+	value, _ := trailer.Value()
+	conf.trailer = byte(value)
+	if conf.MaxMessageSize <= 0 {
+		return nil, fmt.Errorf("invalid max_message_size %d", conf.MaxMessageSize)
+	}
+
+	if _, ok := raw["codec"]; ok {
+		conf.Codec, err = config.GetCodecOrDefault(ctx, raw)
+		return &conf, err
+	}
+	filter, err := filtersyslog.InitHandler(ctx, raw, control)
+	if err != nil {
+		return nil, err
+	}
+	conf.filter = filter.(*filtersyslog.FilterConfig)
+	return &conf, nil
+}
+
+// loadTLS returns the server config for tls
+func (t *InputConfig) loadTLS() (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	result := &tls.Config{Certificates: []tls.Certificate{cert}}
+	if len(t.CAFile) > 0 {
+		ca, err := os.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		result.ClientCAs = x509.NewCertPool()
+		if !result.ClientCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificates in %s", t.CAFile)
+		}
+		result.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return result, nil
+}
+
+// Start wraps the actual function starting the plugin
+func (t *InputConfig) Start(ctx context.Context, msgChan chan<- logevent.LogEvent) (err error) {
+	if t.Socket == SocketUDP {
+		conn, err := net.ListenPacket("udp", t.Address)
+		if err != nil {
+			return err
+		}
+		return t.serveUDP(ctx, conn, msgChan)
+	}
+	var l net.Listener
+	if t.Socket == SocketTLS {
+		l, err = tls.Listen("tcp", t.Address, t.tlsConfig)
+	} else {
+		l, err = net.Listen("tcp", t.Address)
+	}
+	if err != nil {
+		return err
+	}
+	return t.serveStream(ctx, l, msgChan)
+}
+
+// serveUDP reads one message from each datagram on 'conn' until ctx is done. Datagrams larger than MaxMessageSize
+// are dropped.
+func (t *InputConfig) serveUDP(ctx context.Context, conn net.PacketConn, msgChan chan<- logevent.LogEvent) error {
+	t.listener = conn.LocalAddr().String()
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+	// one byte more than the max, so larger datagrams are detected instead of cut short
+	buf := make([]byte, t.MaxMessageSize+1)
+	for {
+		n, peer, err := conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		if n > t.MaxMessageSize {
+			goglog.Logger.Warnf("%s: %s: message larger than %d bytes dropped", ModuleName, peer, t.MaxMessageSize)
+			continue
+		}
+		t.handle(ctx, bytes.TrimRight(buf[:n], "\r\n\x00"), peer, msgChan)
+	}
+}
+
+// serveStream accepts connections on 'l' until ctx is done
+func (t *InputConfig) serveStream(ctx context.Context, l net.Listener, msgChan chan<- logevent.LogEvent) error {
+	t.listener = l.Addr().String()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	go func() {
+		<-ctx.Done()
+		l.Close()
+	}()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				time.Sleep(time.Second)
+				continue
+			}
+			return err
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			t.serveConn(ctx, conn, msgChan)
+		}()
+	}
+}
+
+// serveConn reads framed messages from 'conn' until it is closed or ctx is done
+func (t *InputConfig) serveConn(ctx context.Context, conn net.Conn, msgChan chan<- logevent.LogEvent) {
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+		conn.Close()
+	}()
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 4096), t.MaxMessageSize+16) // room for the octet count
+	scanner.Split(t.split)
+	for scanner.Scan() {
+		t.handle(ctx, scanner.Bytes(), conn.RemoteAddr(), msgChan)
+	}
+	if err := scanner.Err(); err != nil && ctx.Err() == nil {
+		goglog.Logger.Errorf("%s: %s: %s", ModuleName, conn.RemoteAddr(), err.Error())
+	}
+}
+
+// split is a bufio.SplitFunc that returns one message at a time, using octet-counting or non-transparent framing.
+// The go-syslog framing parsers are not used as they only return messages parsed as RFC5424, the codec needs the message.
+func (t *InputConfig) split(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if len(data) == 0 {
+		return 0, nil, nil
+	}
+	octetCounting := t.Framing == FramingOctetCounting || (t.Framing == FramingAuto && data[0] >= '1' && data[0] <= '9')
+	if octetCounting {
+		sp := bytes.IndexByte(data, ' ')
+		if sp < 0 {
+			if atEOF || len(data) > 10 {
+				return 0, nil, errFrame
+			}
+			return 0, nil, nil
+		}
+		n, err := strconv.Atoi(string(data[:sp]))
+		if err != nil || n <= 0 || n > t.MaxMessageSize {
+			return 0, nil, errFrame
+		}
+		if len(data) < sp+1+n {
+			if atEOF {
+				return 0, nil, errFrame
+			}
+			return 0, nil, nil
+		}
+		return sp + 1 + n, data[sp+1 : sp+1+n], nil
+	}
+	if i := bytes.IndexByte(data, t.trailer); i >= 0 {
+		return i + 1, bytes.TrimRight(data[:i], "\r"), nil
+	}
+	if atEOF {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// handle sends an event for 'message' received from 'peer'
+func (t *InputConfig) handle(ctx context.Context, message []byte, peer net.Addr, msgChan chan<- logevent.LogEvent) {
+	if len(message) == 0 {
+		return
+	}
+	extra := map[string]interface{}{}
+	if peer != nil {
+		extra[t.PeerField] = peer.String()
+	}
+	extra[t.ListenerField] = t.listener
+	if t.filter == nil {
+		// copy the message, the codec may keep it
+		if _, err := t.Codec.Decode(ctx, append([]byte(nil), message...), extra, nil, msgChan); err != nil {
+			goglog.Logger.Errorf("%s: %s", ModuleName, err.Error())
+		}
+		return
+	}
+	event := logevent.LogEvent{
+		Timestamp: time.Now(),
+		Extra:     extra,
+	}
+	event.SetValue(t.filter.Source, string(message))
+	// the event is sent also when parsing fails, the filter has tagged it
+	event, _ = t.filter.Event(ctx, event)
+	select {
+	case msgChan <- event:
+	case <-ctx.Done():
+	}
+}
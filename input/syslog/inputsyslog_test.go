@@ -0,0 +1,230 @@
+package syslog
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/tsaikd/gogstash/config"
+	"github.com/tsaikd/gogstash/config/logevent"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInputConfig_Split(t *testing.T) {
+	const stream = "<34>1 - host1 app - - - one\n" +
+		"27 <34>1 - host2 app - - - two" +
+		"<34>Oct 11 22:14:15 host3 su: three\r\n" +
+		"<34>1 - host4 app - - - four"
+	conf := DefaultInputConfig()
+	conf.trailer = '\n'
+	scanner := bufio.NewScanner(strings.NewReader(stream))
+	scanner.Split(conf.split)
+	var messages []string
+	for scanner.Scan() {
+		messages = append(messages, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"<34>1 - host1 app - - - one",
+		"<34>1 - host2 app - - - two",
+		"<34>Oct 11 22:14:15 host3 su: three",
+		"<34>1 - host4 app - - - four",
+	}
+	if strings.Join(messages, "|") != strings.Join(want, "|") {
+		t.Errorf("expected %q, got %q", want, messages)
+	}
+}
+
+func TestInputConfig_TCP(t *testing.T) {
+	input, err := InitHandler(context.Background(), config.ConfigRaw{"socket": SocketTCP, "format": "auto"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := input.(*InputConfig)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	msgChan := make(chan logevent.LogEvent, 2)
+	done := make(chan error)
+	go func() { done <- conf.serveStream(ctx, l, msgChan) }()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = conn.Write([]byte("27 <34>1 - host1 app - - - one<34>Oct 11 22:14:15 host2 su: two\n")); err != nil {
+		t.Fatal(err)
+	}
+	for _, host := range []string{"host1", "host2"} {
+		select {
+		case event := <-msgChan:
+			if got := event.GetString("hostname"); got != host {
+				t.Errorf("expected hostname %s, got %q", host, got)
+			}
+			if event.GetString(PeerField) != conn.LocalAddr().String() || event.GetString(ListenerField) != l.Addr().String() {
+				t.Errorf("unexpected addresses in %v", event.Extra)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for event")
+		}
+	}
+	conn.Close()
+	cancel()
+	if err = <-done; err != nil {
+		t.Error(err)
+	}
+}
+
+// expectHost waits for an event from 'host' on 'msgChan'
+func expectHost(t *testing.T, msgChan <-chan logevent.LogEvent, host string) logevent.LogEvent {
+	t.Helper()
+	select {
+	case event := <-msgChan:
+		if got := event.GetString("hostname"); got != host {
+			t.Errorf("expected hostname %s, got %q", host, got)
+		}
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for event")
+	}
+	return logevent.LogEvent{}
+}
+
+func TestInputConfig_UDP(t *testing.T) {
+	input, err := InitHandler(context.Background(), config.ConfigRaw{"format": "auto", "max_message_size": 40}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := input.(*InputConfig)
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	msgChan := make(chan logevent.LogEvent)
+	done := make(chan error)
+	go func() { done <- conf.serveUDP(ctx, pc, msgChan) }()
+
+	conn, err := net.Dial("udp", pc.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	// the first message is larger than max_message_size and is dropped, not cut short
+	for _, msg := range []string{"<34>1 - host1 app - - - " + strings.Repeat("x", 100), "<34>1 - host2 app - - - two\n"} {
+		if _, err = conn.Write([]byte(msg)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	event := expectHost(t, msgChan, "host2")
+	if got := event.GetString("syslog_message"); got != "two" {
+		t.Errorf("expected message two, got %q", got)
+	}
+	if event.GetString(PeerField) != conn.LocalAddr().String() || event.GetString(ListenerField) != pc.LocalAddr().String() {
+		t.Errorf("unexpected addresses in %v", event.Extra)
+	}
+	// nobody reads the events, the input must still stop when ctx is done
+	if _, err = conn.Write([]byte("<34>1 - host3 app - - - three")); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+	select {
+	case err = <-done:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("input did not stop")
+	}
+}
+
+func TestInputConfig_TLS(t *testing.T) {
+	certFile, keyFile := writeTestCert(t)
+	input, err := InitHandler(context.Background(), config.ConfigRaw{"socket": SocketTLS, "cert_file": certFile, "key_file": keyFile}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := input.(*InputConfig)
+	l, err := tls.Listen("tcp", "127.0.0.1:0", conf.tlsConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	msgChan := make(chan logevent.LogEvent, 1)
+	done := make(chan error)
+	go func() { done <- conf.serveStream(ctx, l, msgChan) }()
+
+	ca, err := os.ReadFile(certFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(ca)
+	conn, err := tls.Dial("tcp", l.Addr().String(), &tls.Config{RootCAs: roots, ServerName: "localhost"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = conn.Write([]byte("27 <34>1 - host1 app - - - one")); err != nil {
+		t.Fatal(err)
+	}
+	expectHost(t, msgChan, "host1")
+	conn.Close()
+	cancel()
+	if err = <-done; err != nil {
+		t.Error(err)
+	}
+}
+
+// writeTestCert writes a self-signed certificate for localhost and its key, and returns the file names
+func writeTestCert(t *testing.T) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err = os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return
+}
@@ -0,0 +1,431 @@
+package syslog
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	filtersyslog "github.com/helgeolav/gogstash-playground/filter/syslog"
+	"github.com/influxdata/go-syslog/v3/common"
+	"github.com/influxdata/go-syslog/v3/rfc5424"
+	"github.com/tsaikd/gogstash/config"
+	"github.com/tsaikd/gogstash/config/goglog"
+	"github.com/tsaikd/gogstash/config/logevent"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ModuleName is the name used in config file
+const ModuleName = "syslog"
+
+// Sockets to send on
+const (
+	SocketUDP = "udp"
+	SocketTCP = "tcp"
+	SocketTLS = "tls"
+)
+
+// Framing of messages on TCP and TLS (RFC6587)
+const (
+	FramingOctetCounting  = "octet-counting"
+	FramingNonTransparent = "non-transparent"
+)
+
+const rfc5424Timestamp = "2006-01-02T15:04:05.999999Z07:00" // the precision go-syslog accepts
+
+var (
+	errNoAddress = errors.New("address is required")
+	errShutdown  = errors.New("output is shut down")
+)
+
+// builderMu protects the go-syslog message builder, it keeps state in package variables
+var builderMu sync.Mutex
+
+// OutputConfig holds the configuration json fields and internal objects
+type OutputConfig struct {
+	config.OutputConfig
+
+	Address    string `json:"address" yaml:"address"`         // address to send to, host:port
+	Socket     string `json:"socket" yaml:"socket"`           // udp, tcp or tls
+	Format     string `json:"format" yaml:"format"`           // message format, RFC5424 or RFC3164
+	Framing    string `json:"framing" yaml:"framing"`         // framing on tcp and tls, octet-counting or non-transparent
+	CAFile     string `json:"ca_file" yaml:"ca_file"`         // CA for the server certificate, empty to use the system CAs
+	CertFile   string `json:"cert_file" yaml:"cert_file"`     // client certificate for tls
+	KeyFile    string `json:"key_file" yaml:"key_file"`       // client key for tls
+	ServerName string `json:"server_name" yaml:"server_name"` // name in the server certificate, default host from Address
+	Insecure   bool   `json:"insecure" yaml:"insecure"`       // if true the server certificate is not verified
+
+	MessageField        string `json:"message_field" yaml:"message_field"`   // syslog message, the event message is used if the field is not set
+	HostnameField       string `json:"hostname_field" yaml:"hostname_field"` // hostname, this host is used if the field is not set
+	AppNameField        string `yaml:"app_name_field" json:"app_name_field"` // appname
+	SeverityField       string `json:"severity_field" yaml:"severity_field"` // severity, a number or a name like err
+	FacilityField       string `json:"facility_field" yaml:"facility_field"` // facility, a number or a name like local3
+	MessageIdField      string `json:"message_id_field" yaml:"message_id_field"`
+	ProcIDField         string `json:"proc_id_field" yaml:"proc_id_field"`
+	StructuredDataField string `json:"sd_field" yaml:"sd_field"` // structured data, a map of SD-ID -> param -> value
+	Severity            int    `json:"severity" yaml:"severity"` // severity when the event has none
+	Facility            int    `json:"facility" yaml:"facility"` // facility when the event has none
+
+	ReconnectMin int `json:"reconnect_min" yaml:"reconnect_min"` // seconds to wait before the first reconnect
+	ReconnectMax int `json:"reconnect_max" yaml:"reconnect_max"` // max seconds to wait between reconnects
+
+	mu        sync.Mutex    // protects conn, closed and shutdown
+	conn      net.Conn      // current connection, nil if not connected
+	closed    chan struct{} // closed when the server has closed conn, nil on udp
+	shutdown  bool          // true when the context of the output is done
+	tlsConfig *tls.Config   // client config for tls
+	hostname  string        // this host
+}
+
+// DefaultOutputConfig returns an OutputConfig struct with default values
+func DefaultOutputConfig() OutputConfig {
+	return OutputConfig{
+		OutputConfig: config.OutputConfig{
+			CommonConfig: config.CommonConfig{
+				Type: ModuleName,
+			},
+		},
+		Socket:              SocketUDP,
+		Format:              filtersyslog.FormatRFC5424,
+		Framing:             FramingOctetCounting,
+		MessageField:        filtersyslog.MessageField,
+		HostnameField:       filtersyslog.HostnameField,
+		AppNameField:        filtersyslog.AppNameField,
+		SeverityField:       filtersyslog.SeverityField,
+		FacilityField:       filtersyslog.FacilityField,
+		MessageIdField:      filtersyslog.MessageIdField,
+		ProcIDField:         filtersyslog.ProcIDField,
+		StructuredDataField: filtersyslog.StructuredDataField,
+		Severity:            6, // informational
+		Facility:            1, // user-level
+		ReconnectMin:        1,
+		ReconnectMax:        60,
+	}
+}
+
+// InitHandler initialize the output plugin
+func InitHandler(ctx context.Context, raw config.ConfigRaw, control config.Control) (config.TypeOutputConfig, error) {
+	conf := DefaultOutputConfig()
+	err := config.ReflectConfig(raw, &conf)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(conf.Address) == 0 {
+		return nil, errNoAddress
+	}
+	switch conf.Socket {
+	case SocketUDP, SocketTCP:
+	case SocketTLS:
+		if conf.tlsConfig, err = conf.loadTLS(); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("invalid socket %q", conf.Socket)
+	}
+	conf.Format = strings.ToUpper(conf.Format)
+	switch conf.Format {
+	case filtersyslog.FormatRFC5424, filtersyslog.FormatRFC3164:
+	default:
+		return nil, fmt.Errorf("invalid format %q", conf.Format)
+	}
+	switch conf.Framing {
+	case FramingOctetCounting, FramingNonTransparent:
+	default:
+		return nil, fmt.Errorf("invalid framing %q", conf.Framing)
+	}
+	if conf.Severity < 0 || conf.Severity > 7 || conf.Facility < 0 || conf.Facility > 23 {
+		return nil, errors.New("invalid severity or facility")
+	}
+	if conf.ReconnectMin <= 0 || conf.ReconnectMax < conf.ReconnectMin {
+		return nil, errors.New("invalid reconnect_min or reconnect_max")
+	}
+	conf.hostname, _ = os.Hostname()
+	go conf.closeOnDone(ctx)
+
+	return &conf, nil
+}
+
+// loadTLS returns the client config for tls
+func (t *OutputConfig) loadTLS() (*tls.Config, error) {
+	result := &tls.Config{ServerName: t.ServerName, InsecureSkipVerify: t.Insecure}
+	if len(result.ServerName) == 0 {
+		host, _, err := net.SplitHostPort(t.Address)
+		if err != nil {
+			return nil, err
+		}
+		result.ServerName = host
+	}
+	if len(t.CAFile) > 0 {
+		ca, err := os.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		result.RootCAs = x509.NewCertPool()
+		if !result.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificates in %s", t.CAFile)
+		}
+	}
+	if len(t.CertFile) > 0 {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		result.Certificates = []tls.Certificate{cert}
+	}
+	return result, nil
+}
+
+// Output event
+func (t *OutputConfig) Output(ctx context.Context, event logevent.LogEvent) (err error) {
+	msg, err := t.render(event)
+	if err != nil {
+		return err
+	}
+	data := t.frame(msg)
+	// try to send twice, the connection may have been closed by the server since the last event
+	for retry := 0; retry < 2; retry++ {
+		var conn net.Conn
+		if conn, err = t.getConn(ctx); err != nil {
+			return err
+		}
+		if _, err = conn.Write(data); err == nil {
+			return nil
+		}
+		goglog.Logger.Warnf("%s: %s", ModuleName, err.Error())
+		t.dropConn(conn)
+	}
+	return err
+}
+
+// getConn returns the current connection, or connects if there is none or the server has closed it
+func (t *OutputConfig) getConn(ctx context.Context) (net.Conn, error) {
+	t.mu.Lock()
+	if t.shutdown {
+		t.mu.Unlock()
+		return nil, errShutdown
+	}
+	if t.conn != nil && t.isClosed() {
+		t.conn.Close()
+		t.conn = nil
+	}
+	conn := t.conn
+	t.mu.Unlock()
+	if conn != nil {
+		return conn, nil
+	}
+	// connect without holding mu, so other calls and shutdown are not blocked by a dead endpoint
+	conn, closed, err := t.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	switch {
+	case t.shutdown:
+		conn.Close()
+		return nil, errShutdown
+	case t.conn != nil:
+		// another call connected at the same time
+		conn.Close()
+		return t.conn, nil
+	}
+	t.conn, t.closed = conn, closed
+	return conn, nil
+}
+
+// dropConn closes 'conn' after a failed write, so the next call connects again
+func (t *OutputConfig) dropConn(conn net.Conn) {
+	t.mu.Lock()
+	if t.conn == conn {
+		t.conn = nil
+	}
+	t.mu.Unlock()
+	conn.Close()
+}
+
+// closeOnDone closes the connection when ctx is done, later events are not sent
+func (t *OutputConfig) closeOnDone(ctx context.Context) {
+	<-ctx.Done()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.shutdown = true
+	if t.conn != nil {
+		t.conn.Close()
+		t.conn = nil
+	}
+}
+
+// isClosed returns true if the server has closed the connection. A write to a closed connection may succeed, and the
+// event would be lost, so this is checked before each write. Must be called with mu held.
+func (t *OutputConfig) isClosed() bool {
+	select {
+	case <-t.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// watch reads from 'conn' until it is closed and then closes 'closed'. Syslog servers do not send anything.
+func watch(conn net.Conn, closed chan<- struct{}) {
+	_, _ = io.Copy(io.Discard, conn)
+	close(closed)
+}
+
+// connect connects to Address, retrying with backoff until it succeeds or ctx is done. 'closed' is closed when the
+// server closes the connection, it is nil on udp.
+func (t *OutputConfig) connect(ctx context.Context) (conn net.Conn, closed chan struct{}, err error) {
+	wait := time.Duration(t.ReconnectMin) * time.Second
+	for {
+		dialer := net.Dialer{Timeout: 10 * time.Second}
+		switch t.Socket {
+		case SocketTLS:
+			tlsDialer := tls.Dialer{NetDialer: &dialer, Config: t.tlsConfig}
+			conn, err = tlsDialer.DialContext(ctx, "tcp", t.Address)
+		case SocketTCP:
+			conn, err = dialer.DialContext(ctx, "tcp", t.Address)
+		default:
+			conn, err = dialer.DialContext(ctx, "udp", t.Address)
+		}
+		if err == nil {
+			if t.Socket != SocketUDP {
+				closed = make(chan struct{})
+				go watch(conn, closed)
+			}
+			return conn, closed, nil
+		}
+		goglog.Logger.Errorf("%s: %s, retrying in %s", ModuleName, err.Error(), wait)
+		select {
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		case <-time.After(wait):
+		}
+		wait *= 2
+		if max := time.Duration(t.ReconnectMax) * time.Second; wait > max {
+			wait = max
+		}
+	}
+}
+
+// frame returns 'msg' framed for the socket
+func (t *OutputConfig) frame(msg string) []byte {
+	switch {
+	case t.Socket == SocketUDP:
+		return []byte(msg)
+	case t.Framing == FramingOctetCounting:
+		return []byte(strconv.Itoa(len(msg)) + " " + msg)
+	default:
+		return []byte(msg + "\n")
+	}
+}
+
+// render returns the event as a syslog message
+func (t *OutputConfig) render(event logevent.LogEvent) (string, error) {
+	severity := level(event.Get(t.SeverityField), t.Severity, 7, common.SeverityLevelsShort, common.SeverityLevels)
+	facility := level(event.Get(t.FacilityField), t.Facility, 23, common.FacilityKeywords)
+	priority := uint8(facility*8 + severity)
+	message := event.GetString(t.MessageField)
+	if len(message) == 0 {
+		message = event.Message
+	}
+	hostname := event.GetString(t.HostnameField)
+	if len(hostname) == 0 {
+		hostname = t.hostname
+	}
+	appname := event.GetString(t.AppNameField)
+	procID := event.GetString(t.ProcIDField)
+
+	if t.Format == filtersyslog.FormatRFC3164 {
+		tag := appname
+		if len(tag) > 0 && len(procID) > 0 {
+			tag += "[" + procID + "]"
+		}
+		if len(tag) > 0 {
+			tag += ": "
+		}
+		return fmt.Sprintf("<%d>%s %s %s%s", priority, event.Timestamp.Format(time.Stamp), hostname, tag, message), nil
+	}
+
+	builderMu.Lock()
+	defer builderMu.Unlock()
+	msg := &rfc5424.SyslogMessage{}
+	msg.SetPriority(priority)
+	msg.SetVersion(1)
+	if !event.Timestamp.IsZero() {
+		msg.SetTimestamp(event.Timestamp.Format(rfc5424Timestamp))
+	}
+	msg.SetHostname(hostname)
+	msg.SetAppname(appname)
+	msg.SetProcID(procID)
+	msg.SetMsgID(event.GetString(t.MessageIdField))
+	if sd, ok := event.Get(t.StructuredDataField).(map[string]interface{}); ok {
+		for _, id := range sortedKeys(sd) {
+			params, ok := sd[id].(map[string]interface{})
+			if !ok {
+				continue
+			}
+			msg.SetElementID(id)
+			for _, name := range sortedKeys(params) {
+				msg.SetParameter(id, name, fmt.Sprint(params[name]))
+			}
+		}
+	}
+	if len(message) > 0 {
+		msg.SetMessage(message)
+	}
+	return msg.String()
+}
+
+// level returns severity or facility from 'value', either a number or a name found in 'names'.
+// 'def' is returned if value is not set or is invalid.
+func level(value interface{}, def int, max int, names ...map[uint8]string) int {
+	var n int
+	switch v := value.(type) {
+	case nil:
+		return def
+	case uint8:
+		n = int(v)
+	case int:
+		n = v
+	case int64:
+		n = int(v)
+	case float64:
+		n = int(v)
+	case string:
+		var err error
+		if n, err = strconv.Atoi(v); err != nil {
+			n = -1
+			for _, m := range names {
+				for number, name := range m {
+					if name == v {
+						n = int(number)
+					}
+				}
+			}
+		}
+	default:
+		return def
+	}
+	if n < 0 || n > max {
+		return def
+	}
+	return n
+}
+
+// sortedKeys returns the keys in 'm' in order
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,150 @@
+package syslog
+
+import (
+	"bufio"
+	"context"
+	"github.com/tsaikd/gogstash/config"
+	"github.com/tsaikd/gogstash/config/logevent"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testEvent returns an event with the fields the syslog filter sets
+func testEvent() logevent.LogEvent {
+	event := logevent.LogEvent{
+		Timestamp: time.Date(2026, 10, 11, 22, 14, 15, 3000000, time.UTC),
+		Message:   "raw message",
+	}
+	event.SetValue("syslog_message", "An application event")
+	event.SetValue("hostname", "mymachine")
+	event.SetValue("appname", "evntslog")
+	event.SetValue("syslog_proc_id", "1234")
+	event.SetValue("message_id", "ID47")
+	event.SetValue("severity", "notice")
+	event.SetValue("facility", float64(20))
+	event.SetValue("syslog_sd", map[string]interface{}{
+		"exampleSDID@32473": map[string]interface{}{"iut": "3", "eventSource": "Application"},
+	})
+	return event
+}
+
+// newTestOutput returns an output initialized from 'raw'
+func newTestOutput(t *testing.T, raw config.ConfigRaw) *OutputConfig {
+	t.Helper()
+	o, err := InitHandler(context.Background(), raw, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return o.(*OutputConfig)
+}
+
+func TestOutputConfig_Render(t *testing.T) {
+	checks := map[string]string{
+		"RFC5424": `<165>1 2026-10-11T22:14:15.003Z mymachine evntslog 1234 ID47 [exampleSDID@32473 eventSource="Application" iut="3"] An application event`,
+		"rfc3164": `<165>Oct 11 22:14:15 mymachine evntslog[1234]: An application event`,
+	}
+	for format, want := range checks {
+		o := newTestOutput(t, config.ConfigRaw{"address": "localhost:514", "format": format})
+		got, err := o.render(testEvent())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("%s: expected %q, got %q", format, want, got)
+		}
+	}
+	o := newTestOutput(t, config.ConfigRaw{"address": "localhost:514", "severity": 3})
+	got, err := o.render(logevent.LogEvent{Message: "just text"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "<11>1 - " + o.hostname + " - - - - just text"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestOutputConfig_TCP(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	lines := make(chan string)
+	go func() {
+		// read one message from each connection and close it, so the output has to reconnect
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			line, _ := bufio.NewReader(conn).ReadString(']')
+			conn.Close()
+			lines <- line
+		}
+	}()
+	o := newTestOutput(t, config.ConfigRaw{"address": l.Addr().String(), "socket": SocketTCP})
+	for i := 0; i < 2; i++ {
+		if err = o.Output(context.Background(), testEvent()); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case line := <-lines:
+			if !strings.HasPrefix(line, "135 <165>1 ") {
+				t.Errorf("expected octet-counting frame, got %q", line)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for message")
+		}
+		// wait until the output has seen the server close the connection
+		o.mu.Lock()
+		closed := o.closed
+		o.mu.Unlock()
+		select {
+		case <-closed:
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for the connection to close")
+		}
+	}
+}
+
+func TestOutputConfig_Shutdown(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	received := make(chan string)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		// read until the output closes the connection
+		data, _ := io.ReadAll(conn)
+		conn.Close()
+		received <- string(data)
+	}()
+	ctx, cancel := context.WithCancel(context.Background())
+	o, err := InitHandler(ctx, config.ConfigRaw{"address": l.Addr().String(), "socket": SocketTCP}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = o.Output(context.Background(), testEvent()); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	select {
+	case data := <-received:
+		if !strings.HasPrefix(data, "135 <165>1 ") {
+			t.Errorf("expected octet-counting frame, got %q", data)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("connection not closed on shutdown")
+	}
+	if err = o.Output(context.Background(), testEvent()); err != errShutdown {
+		t.Errorf("expected %v, got %v", errShutdown, err)
+	}
+}
@@ -2,10 +2,14 @@ package main
 
 import (
 	"github.com/helgeolav/gogstash-playground/filter/syslog"
+	inputsyslog "github.com/helgeolav/gogstash-playground/input/syslog"
+	outputsyslog "github.com/helgeolav/gogstash-playground/output/syslog"
 	"github.com/tsaikd/gogstash/config"
 )
 
-// init registers syslog filter
+// init registers syslog filter, input and output
 func init() {
 	config.RegistFilterHandler(syslog.ModuleName, syslog.InitHandler)
+	config.RegistInputHandler(inputsyslog.ModuleName, inputsyslog.InitHandler)
+	config.RegistOutputHandler(outputsyslog.ModuleName, outputsyslog.InitHandler)
 }
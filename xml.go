@@ -2,9 +2,11 @@ package main
 
 import (
 	"github.com/helgeolav/gogstash-playground/codec/xml"
+	filterxml "github.com/helgeolav/gogstash-playground/filter/xml"
 	"github.com/tsaikd/gogstash/config"
 )
 
 func init() {
 	config.RegistCodecHandler(xml.ModuleName, xml.InitHandler)
+	config.RegistFilterHandler(filterxml.ModuleName, filterxml.InitHandler)
 }